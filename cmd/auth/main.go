@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,10 +17,17 @@ import (
 	"github.com/DarRo9/Test-task-BackDev/internal/config"
 	"github.com/DarRo9/Test-task-BackDev/internal/http-server/handler"
 	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/logger"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
 	"github.com/DarRo9/Test-task-BackDev/internal/lib/logger/sl"
+	"github.com/DarRo9/Test-task-BackDev/internal/metrics"
+	"github.com/DarRo9/Test-task-BackDev/internal/notifier"
 	"github.com/DarRo9/Test-task-BackDev/internal/server"
 	"github.com/DarRo9/Test-task-BackDev/internal/service"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/memory"
 	"github.com/DarRo9/Test-task-BackDev/internal/storage/mongodb"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/postgres"
+	"github.com/DarRo9/Test-task-BackDev/internal/tracing"
+	"github.com/DarRo9/Test-task-BackDev/pkg/authn"
 	"github.com/joho/godotenv"
 	"golang.org/x/exp/slog"
 )
@@ -26,10 +36,14 @@ const (
 	dev   = "dev"
 	prod  = "prod"
 	local = "local"
+
+	envFile = "config.env"
 )
 
 func main() {
-	err := godotenv.Load("config.env")
+	processEnv := environKeys()
+
+	err := godotenv.Load(envFile)
 	if err != nil {
 		log.Fatal("Failed loading .env file")
 	}
@@ -43,30 +57,45 @@ func main() {
 		slog.String("env", config.Env))
 	log.Debug("Messages about debug are enabled")
 
-	mongoClient, err := mongodb.CreateObjectClient(config.Mongo.URI, config.Mongo.User, config.Mongo.Password)
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing)
 	if err != nil {
-		log.Error("Fail of initiation storage", sl.Err(err))
+		log.Error("Fail of initiation tracing", sl.Err(err))
 		os.Exit(1)
 	}
 
-	mongoDatabase := mongodb.CreateObjectStorage(mongoClient, config.Mongo.Database)
-	mongoRefreshRepo := mongoDatabase.CreateObjectRefreshRepo()
+	metrics := metrics.CreateObjectPrometheus()
 
-	tokenAuthenticator, err := auth.CreateObject(config.JWT.SigningKey)
+	refreshRepo, closeStorage, err := setupStorage(config, metrics)
+	if err != nil {
+		log.Error("Fail of initiation storage", sl.Err(err))
+		os.Exit(1)
+	}
+
+	tokenAuthenticator, err := setupAuthenticator(config, processEnv)
 	if err != nil {
 		log.Error("Fail of initiation auth", sl.Err(err))
 		os.Exit(1)
 	}
 
-	service, err := service.CreateObject(config, mongoRefreshRepo, tokenAuthenticator)
+	mailNotifier, err := setupNotifier(config, log)
+	if err != nil {
+		log.Error("Fail of initiation notifier", sl.Err(err))
+		os.Exit(1)
+	}
+
+	storage := service.CreateObjectTimeoutStorage(refreshRepo, config.Storage.Timeouts)
+
+	service, err := service.CreateObject(config, storage, tokenAuthenticator, service.CreateObjectProfileClaims(storage), mailNotifier, metrics, log)
 	if err != nil {
 		log.Error("Fail of initiation service", sl.Err(err))
 		os.Exit(1)
 	}
 
-	logger := logger.Log
+	logger := logger.CreateObjectMiddleware(log)
 
-	h := handler.CreateObject(config, service, logger)
+	authenticate := authn.Authenticate(tokenAuthenticator, service)
+
+	h := handler.CreateObject(config, service, logger, authenticate, metrics)
 
 	srv := server.CreateObject(config, h.CreateObjectRouter())
 
@@ -77,8 +106,28 @@ func main() {
 		}
 	}()
 
+	metricsSrv := server.CreateObjectMetrics(config, metrics.Handler())
+
+	go func() {
+		if err := metricsSrv.Start(); !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Fail of initiation metrics server", sl.Err(err))
+			os.Exit(1)
+		}
+	}()
+
 	log.Info("Start server")
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for range reload {
+			if err := service.ReloadKeys(context.Background()); err != nil {
+				log.Error("Fail of reloading signing keys", sl.Err(err))
+			}
+		}
+	}()
+
 	// Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
@@ -95,27 +144,224 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := mongoClient.Disconnect(context.Background()); err != nil {
-		log.Error("Fail of stopping mongo client", sl.Err(err))
+	if err := metricsSrv.Stop(ctx); err != nil {
+		log.Error("Fail of stopping metrics server", sl.Err(err))
+	}
+
+	if err := mailNotifier.Close(ctx); err != nil {
+		log.Error("Fail of stopping notifier", sl.Err(err))
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("Fail of flushing traces", sl.Err(err))
+	}
+
+	if err := closeStorage(context.Background()); err != nil {
+		log.Error("Fail of stopping storage", sl.Err(err))
 		os.Exit(1)
 	}
 }
 
+func setupStorage(config *config.Config, metrics mongodb.Metrics) (service.Storage, func(context.Context) error, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch config.Storage.Driver {
+	case "memory":
+		closeStorage := func(context.Context) error {
+			return nil
+		}
+
+		return memory.CreateObjectStorage().CreateObjectRefreshRepo(), closeStorage, nil
+	case "postgres":
+		pg := config.Storage.Postgres
+
+		pool, err := postgres.CreateObjectPool(pg.URI, pg.MaxConns, pg.MinConns, pg.MaxConnLifetime)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		postgresDatabase := postgres.CreateObjectStorage(pool)
+		if err := postgresDatabase.Migrate(ctx); err != nil {
+			pool.Close()
+			return nil, nil, err
+		}
+
+		closeStorage := func(context.Context) error {
+			pool.Close()
+			return nil
+		}
+
+		return postgresDatabase.CreateObjectRefreshRepo(), closeStorage, nil
+	default:
+		mongoClient, err := mongodb.CreateObjectClient(config.Mongo.URI, config.Mongo.User, config.Mongo.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		mongoDatabase := mongodb.CreateObjectStorage(mongoClient, config.Mongo.Database)
+		mongoRefreshRepo := mongoDatabase.CreateObjectRefreshRepo()
+		mongoRefreshRepo.SetMetrics(metrics)
+
+		if err := mongoRefreshRepo.CreateIndexes(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		if err := mongoRefreshRepo.DetectTransactions(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		return mongoRefreshRepo, mongoClient.Disconnect, nil
+	}
+}
+
+func setupAuthenticator(config *config.Config, processEnv map[string]bool) (*auth.Authenticator, error) {
+	keys, err := auth.CreateObjectKeyRing(setupKeyLoader(config, processEnv), config.JWT.KeyGracePeriod, config.JWT.PreviousNotAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access tokens issued before iss and aud were configured expire within one AccessTokenTTL.
+	tokenAuthenticator, err := auth.CreateObjectWithKeyRing(keys, config.JWT.RefreshTokenKey, auth.Validation{
+		Issuer:        config.JWT.Issuer,
+		Audience:      config.JWT.Audience,
+		UnscopedUntil: time.Now().Add(config.JWT.AccessTokenTTL + config.JWT.Leeway),
+		Leeway:        config.JWT.Leeway,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenAuthenticator, nil
+}
+
+// setupKeyLoader re-reads the env file and the PEM files on every reload,
+// so signing keys can be rotated without a restart. Variables the process was
+// started with are never replaced by the file. A reload that resolves the signing
+// key to a placeholder fails outside the local env, the key in use stays.
+func setupKeyLoader(cfg *config.Config, processEnv map[string]bool) auth.KeyLoader {
+	reloading := false
+
+	return func() (*auth.SigningKey, []*auth.SigningKey, error) {
+		if err := loadEnvFile(processEnv); err != nil {
+			return nil, nil, err
+		}
+
+		reloaded := *cfg
+		config.MakeEnvSettings(&reloaded)
+		jwtConfig := reloaded.JWT
+
+		if reloading && cfg.Env != local && jwtConfig.Algorithm == auth.AlgHS512 && config.IsPlaceholderSecret(jwtConfig.SigningKey) {
+			return nil, nil, errors.New("JWT_SIGNING_KEY is a placeholder")
+		}
+		reloading = true
+
+		var current *auth.SigningKey
+		var err error
+
+		if jwtConfig.Algorithm == auth.AlgHS512 {
+			current, err = auth.CreateObjectHMACKey(jwtConfig.KeyID, jwtConfig.SigningKey)
+		} else {
+			current, err = auth.LoadSigningKey(jwtConfig.Algorithm, jwtConfig.KeyID, jwtConfig.PrivateKeyPath)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		previous := make([]*auth.SigningKey, 0, len(jwtConfig.PreviousKeys)+len(jwtConfig.PreviousKeyPaths))
+
+		for _, secret := range jwtConfig.PreviousKeys {
+			key, err := auth.CreateObjectHMACKey("", secret)
+			if err != nil {
+				return nil, nil, err
+			}
+			previous = append(previous, key)
+		}
+
+		for _, path := range jwtConfig.PreviousKeyPaths {
+			key, err := auth.LoadSigningKey("", "", path)
+			if err != nil {
+				return nil, nil, err
+			}
+			previous = append(previous, key)
+		}
+
+		return current, previous, nil
+	}
+}
+
+// environKeys lists the variables of the process environment before the env file is loaded.
+func environKeys() map[string]bool {
+	keys := make(map[string]bool)
+
+	for _, variable := range os.Environ() {
+		key, _, _ := strings.Cut(variable, "=")
+		keys[key] = true
+	}
+
+	return keys
+}
+
+// loadEnvFile sets the variables of the env file that are not in processEnv.
+func loadEnvFile(processEnv map[string]bool) error {
+	values, err := godotenv.Read(envFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if processEnv[key] {
+			continue
+		}
+
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setupNotifier(config *config.Config, log *slog.Logger) (*notifier.Async, error) {
+	var next notifier.Notifier
+
+	switch config.Notifier.Driver {
+	case "smtp":
+		smtp := config.Notifier.SMTP
+		next = notifier.CreateObjectSMTP(smtp.Host, smtp.Port, smtp.User, smtp.Password, smtp.From, config.Notifier.Timeout)
+	case "outbox":
+		outbox, err := notifier.CreateObjectOutbox(config.Notifier.OutboxPath)
+		if err != nil {
+			return nil, err
+		}
+		next = outbox
+	case "noop":
+		next = notifier.CreateObjectNoop()
+	default:
+		return nil, fmt.Errorf("unknown notifier driver: %s", config.Notifier.Driver)
+	}
+
+	return notifier.CreateObjectAsync(next, log, config.Notifier.QueueSize, config.Notifier.Retries, config.Notifier.RetryDelay), nil
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
 	case local:
 		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			requestid.CreateObjectLogHandler(tracing.CreateObjectLogHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))),
 		)
 	case dev:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			requestid.CreateObjectLogHandler(tracing.CreateObjectLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))),
 		)
 	case prod:
 		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
+			requestid.CreateObjectLogHandler(tracing.CreateObjectLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))),
 		)
 	}
 
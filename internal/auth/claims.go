@@ -0,0 +1,10 @@
+package auth
+
+import "github.com/DarRo9/Test-task-BackDev/pkg/accesstoken"
+
+// The claims types are public so that other services can read them through pkg/authn.
+type (
+	Claims                 = accesstoken.Claims
+	IndividualRequirements = accesstoken.IndividualRequirements
+	Audience               = accesstoken.Audience
+)
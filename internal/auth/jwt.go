@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenCodec hides the JWT library from the rest of the package.
+type tokenCodec interface {
+	sign(claims *IndividualRequirements, key *SigningKey) (string, error)
+	parse(accessToken string, claims *IndividualRequirements, options parseOptions) error
+}
+
+type parseOptions struct {
+	algorithms           []string
+	issuer               string
+	audience             []string
+	leeway               time.Duration
+	skipClaimsValidation bool
+	// key returns the verification key for the kid from the header, which is empty when absent.
+	key func(keyID string, algorithm string) (interface{}, error)
+}
+
+var codec tokenCodec = jwtCodec{}
+
+type jwtCodec struct{}
+
+func (jwtCodec) sign(claims *IndividualRequirements, key *SigningKey) (string, error) {
+	method := jwt.GetSigningMethod(key.Algorithm())
+	if method == nil {
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSigningKey, key.Algorithm())
+	}
+
+	token := jwt.NewWithClaims(method, jwtClaims{claims})
+	if key.ID() != "" {
+		token.Header["kid"] = key.ID()
+	}
+
+	return token.SignedString(key.signKey)
+}
+
+func (jwtCodec) parse(accessToken string, claims *IndividualRequirements, options parseOptions) error {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(options.algorithms),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(options.leeway),
+	}
+
+	if options.skipClaimsValidation {
+		parserOptions = append(parserOptions, jwt.WithoutClaimsValidation())
+	}
+
+	if options.issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.issuer))
+	}
+
+	if len(options.audience) > 0 {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.audience...))
+	}
+
+	_, err := jwt.NewParser(parserOptions...).ParseWithClaims(accessToken, &jwtClaims{claims}, func(token *jwt.Token) (interface{}, error) {
+		var keyID string
+
+		if header, ok := token.Header["kid"]; ok {
+			if keyID, ok = header.(string); !ok {
+				return nil, errors.New("kid is not a string")
+			}
+		}
+
+		return options.key(keyID, token.Method.Alg())
+	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return fmt.Errorf("%w: %s", ErrExpiredAccessToken, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAccessToken, err)
+	}
+
+	return nil
+}
+
+// jwtClaims lets the library read registered claims from IndividualRequirements.
+type jwtClaims struct {
+	*IndividualRequirements
+}
+
+func (c jwtClaims) GetExpirationTime() (*jwt.NumericDate, error) {
+	return numericDate(c.ExpiresAt), nil
+}
+
+func (c jwtClaims) GetIssuedAt() (*jwt.NumericDate, error) {
+	return numericDate(c.IssuedAt), nil
+}
+
+func (c jwtClaims) GetNotBefore() (*jwt.NumericDate, error) {
+	return numericDate(c.NotBefore), nil
+}
+
+func (c jwtClaims) GetIssuer() (string, error) {
+	return c.Issuer, nil
+}
+
+func (c jwtClaims) GetSubject() (string, error) {
+	return c.Subject, nil
+}
+
+func (c jwtClaims) GetAudience() (jwt.ClaimStrings, error) {
+	return jwt.ClaimStrings(c.Audience), nil
+}
+
+func numericDate(unix int64) *jwt.NumericDate {
+	if unix == 0 {
+		return nil
+	}
+
+	return jwt.NewNumericDate(time.Unix(unix, 0))
+}
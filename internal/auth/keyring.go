@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrKeyIDReused means the loader returned new key material under a kid that is already in use.
+// Verifiers cache keys by kid, so such a key has to get a new kid instead.
+var ErrKeyIDReused = errors.New("key id reused for different key material")
+
+// KeyLoader returns the key that should sign new tokens and the keys that must still verify old ones.
+type KeyLoader func() (current *SigningKey, previous []*SigningKey, err error)
+
+type verificationKey struct {
+	key      *SigningKey
+	retireAt time.Time
+}
+
+// KeyRing holds one current signing key and the previous keys that still verify tokens.
+// A replaced key keeps verifying for gracePeriod, which must outlive AccessTokenTTL.
+// The keys given by the loader as previous stop verifying at previousNotAfter,
+// or gracePeriod after they were first seen when it is zero.
+type KeyRing struct {
+	mu               sync.RWMutex
+	load             KeyLoader
+	gracePeriod      time.Duration
+	previousNotAfter time.Time
+	current          *SigningKey
+	previous         []verificationKey
+	retireAt         map[string]time.Time
+	now              func() time.Time
+}
+
+func CreateObjectKeyRing(load KeyLoader, gracePeriod time.Duration, previousNotAfter time.Time) (*KeyRing, error) {
+	const op = "auth.CreateObjectKeyRing"
+
+	if gracePeriod <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("grace period must be positive"))
+	}
+
+	r := &KeyRing{
+		load:             load,
+		gracePeriod:      gracePeriod,
+		previousNotAfter: previousNotAfter,
+		retireAt:         make(map[string]time.Time),
+		now:              time.Now,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return r, nil
+}
+
+// CreateObjectStaticKeyRing wraps a single key that is never reloaded.
+func CreateObjectStaticKeyRing(key *SigningKey) *KeyRing {
+	return &KeyRing{
+		current: key,
+		now:     time.Now,
+	}
+}
+
+// Reload asks the loader for keys again. When the current kid changes,
+// the old key is kept for verification until the grace period ends.
+// A known kid with different key material fails the reload and keeps the keys in use.
+func (r *KeyRing) Reload() (bool, error) {
+	const op = "auth.KeyRing.Reload"
+
+	if r.load == nil {
+		return false, nil
+	}
+
+	current, previous, err := r.load()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if current == nil {
+		return false, fmt.Errorf("%s: %w", op, ErrInvalidSigningKey)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range append([]*SigningKey{current}, previous...) {
+		if known := r.known(key.ID()); known != nil && !known.sameMaterial(key) {
+			return false, fmt.Errorf("%s: %w: %s", op, ErrKeyIDReused, key.ID())
+		}
+	}
+
+	now := r.now()
+	rotated := false
+
+	if r.current == nil || r.current.ID() != current.ID() {
+		replaced := r.current
+		r.current = current
+		rotated = true
+
+		// A key that signs again gets a new grace period once it is replaced.
+		delete(r.retireAt, current.ID())
+
+		if replaced != nil {
+			r.retire(replaced, now.Add(r.gracePeriod), false)
+		}
+	}
+
+	for _, key := range previous {
+		if r.previousNotAfter.IsZero() {
+			r.retire(key, now.Add(r.gracePeriod), false)
+		} else {
+			r.retire(key, r.previousNotAfter, true)
+		}
+	}
+
+	r.prune(now)
+
+	return rotated, nil
+}
+
+// known returns the key held under keyID, retired or not.
+func (r *KeyRing) known(keyID string) *SigningKey {
+	if r.current != nil && r.current.ID() == keyID {
+		return r.current
+	}
+
+	for _, v := range r.previous {
+		if v.key.ID() == keyID {
+			return v.key
+		}
+	}
+
+	return nil
+}
+
+// retire keeps the key for verification until retireAt, unless it is the current one.
+// A key seen before keeps its first retirement time, even after it was pruned,
+// so reloading does not extend it. An explicit retirement time replaces the known one.
+func (r *KeyRing) retire(key *SigningKey, retireAt time.Time, explicit bool) {
+	if key.ID() == r.current.ID() {
+		return
+	}
+
+	if known, ok := r.retireAt[key.ID()]; ok && !explicit {
+		retireAt = known
+	}
+	r.retireAt[key.ID()] = retireAt
+
+	for i, v := range r.previous {
+		if v.key.ID() == key.ID() {
+			r.previous[i].retireAt = retireAt
+			return
+		}
+	}
+
+	r.previous = append(r.previous, verificationKey{
+		key:      key,
+		retireAt: retireAt,
+	})
+}
+
+func (r *KeyRing) prune(now time.Time) {
+	previous := r.previous[:0]
+
+	for _, v := range r.previous {
+		if v.key.ID() != r.current.ID() && now.Before(v.retireAt) {
+			previous = append(previous, v)
+		}
+	}
+
+	r.previous = previous
+}
+
+func (r *KeyRing) Current() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.current
+}
+
+// Lookup finds a key that may still verify tokens with the given kid.
+func (r *KeyRing) Lookup(keyID string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.current.ID() == keyID {
+		return r.current, true
+	}
+
+	now := r.now()
+
+	for _, v := range r.previous {
+		if v.key.ID() == keyID && now.Before(v.retireAt) {
+			return v.key, true
+		}
+	}
+
+	return nil, false
+}
+
+// Keys returns the current key followed by the previous keys that are not retired yet.
+func (r *KeyRing) Keys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	keys := []*SigningKey{r.current}
+
+	for _, v := range r.previous {
+		if now.Before(v.retireAt) {
+			keys = append(keys, v.key)
+		}
+	}
+
+	return keys
+}
+
+func (r *KeyRing) algorithms() []string {
+	var algorithms []string
+
+	for _, key := range r.Keys() {
+		if !slices.Contains(algorithms, key.Algorithm()) {
+			algorithms = append(algorithms, key.Algorithm())
+		}
+	}
+
+	return algorithms
+}
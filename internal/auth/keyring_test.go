@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testKeyLoader struct {
+	current  *SigningKey
+	previous []*SigningKey
+	err      error
+}
+
+func (l *testKeyLoader) load() (*SigningKey, []*SigningKey, error) {
+	return l.current, l.previous, l.err
+}
+
+func createObjectTestEdDSAKey(t *testing.T, keyID string) *SigningKey {
+	key, err := ParseSigningKey(AlgEdDSA, keyID, encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)))
+	require.NoError(t, err)
+
+	return key
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	loader := &testKeyLoader{current: createObjectTestEdDSAKey(t, "first")}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	m, err := CreateObjectWithKeyRing(keys, "67890", Validation{})
+	require.NoError(t, err)
+
+	oldToken, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	loader.current = createObjectTestEdDSAKey(t, "second")
+
+	rotated, err := m.ReloadKeys()
+	require.NoError(t, err)
+	require.True(t, rotated)
+	require.Equal(t, "second", keys.Current().ID())
+
+	newToken, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(oldToken)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(newToken)
+	require.NoError(t, err)
+
+	jwks := m.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	require.Equal(t, "second", jwks.Keys[0].Kid)
+	require.Equal(t, "first", jwks.Keys[1].Kid)
+
+	rotated, err = m.ReloadKeys()
+	require.NoError(t, err)
+	require.False(t, rotated)
+
+	now = now.Add(time.Hour + time.Second)
+
+	_, err = m.ParseJWT(oldToken)
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+
+	_, err = m.GetPairID(oldToken, "data")
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+
+	require.Len(t, m.JWKS().Keys, 1)
+}
+
+func TestKeyRingPreviousKeys(t *testing.T) {
+	previous := createObjectTestEdDSAKey(t, "previous")
+	loader := &testKeyLoader{current: createObjectTestEdDSAKey(t, "current"), previous: []*SigningKey{previous}}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	other, err := CreateObjectWithKey(previous, "67890")
+	require.NoError(t, err)
+
+	oldToken, err := other.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	m, err := CreateObjectWithKeyRing(keys, "67890", Validation{})
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(oldToken)
+	require.NoError(t, err)
+
+	loader.current, loader.previous = previous, nil
+
+	rotated, err := keys.Reload()
+	require.NoError(t, err)
+	require.True(t, rotated)
+	require.Len(t, keys.Keys(), 2)
+	require.Equal(t, "previous", keys.Keys()[0].ID())
+	require.Equal(t, "current", keys.Keys()[1].ID())
+}
+
+func TestKeyRingPreviousKeysRetireOnce(t *testing.T) {
+	previous := createObjectTestEdDSAKey(t, "previous")
+	loader := &testKeyLoader{current: createObjectTestEdDSAKey(t, "current"), previous: []*SigningKey{previous}}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	now = now.Add(30 * time.Minute)
+
+	_, err = keys.Reload()
+	require.NoError(t, err)
+
+	_, ok := keys.Lookup("previous")
+	require.True(t, ok)
+
+	now = now.Add(31 * time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err = keys.Reload()
+		require.NoError(t, err)
+
+		_, ok = keys.Lookup("previous")
+		require.False(t, ok)
+		require.Len(t, keys.Keys(), 1)
+	}
+}
+
+func TestKeyRingReplacedKeyListedAsPrevious(t *testing.T) {
+	first := createObjectTestEdDSAKey(t, "first")
+	loader := &testKeyLoader{current: first}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+
+	loader.current, loader.previous = createObjectTestEdDSAKey(t, "second"), []*SigningKey{first}
+
+	_, err = keys.Reload()
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour + time.Second)
+
+	_, err = keys.Reload()
+	require.NoError(t, err)
+
+	_, ok := keys.Lookup("first")
+	require.False(t, ok)
+	require.Len(t, keys.Keys(), 1)
+}
+
+func TestKeyRingPreviousNotAfter(t *testing.T) {
+	now := time.Now()
+	loader := &testKeyLoader{
+		current:  createObjectTestEdDSAKey(t, "current"),
+		previous: []*SigningKey{createObjectTestEdDSAKey(t, "previous")},
+	}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, now.Add(10*time.Minute))
+	require.NoError(t, err)
+
+	keys.now = func() time.Time { return now }
+
+	_, ok := keys.Lookup("previous")
+	require.True(t, ok)
+
+	now = now.Add(10 * time.Minute)
+
+	_, err = keys.Reload()
+	require.NoError(t, err)
+
+	_, ok = keys.Lookup("previous")
+	require.False(t, ok)
+}
+
+func TestKeyRingMixedAlgorithms(t *testing.T) {
+	loader := &testKeyLoader{current: createObjectTestHMACKey(t, "12345")}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	m, err := CreateObjectWithKeyRing(keys, "67890", Validation{})
+	require.NoError(t, err)
+
+	hmacToken, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	loader.current = createObjectTestEdDSAKey(t, "")
+
+	_, err = keys.Reload()
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(hmacToken)
+	require.NoError(t, err)
+
+	require.Len(t, m.JWKS().Keys, 1)
+}
+
+func TestKeyRingReloadError(t *testing.T) {
+	loader := &testKeyLoader{current: createObjectTestEdDSAKey(t, "first")}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	loader.err = errors.New("no such file")
+
+	_, err = keys.Reload()
+	require.Error(t, err)
+	require.Equal(t, "first", keys.Current().ID())
+
+	_, err = CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.Error(t, err)
+
+	_, err = CreateObjectKeyRing((&testKeyLoader{}).load, 0, time.Time{})
+	require.Error(t, err)
+}
+
+func TestKeyRingKeyIDReused(t *testing.T) {
+	loader := &testKeyLoader{current: createObjectTestEdDSAKey(t, "first")}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	current := keys.Current()
+
+	loader.current = createObjectTestEdDSAKey(t, "first")
+
+	_, err = keys.Reload()
+	require.ErrorIs(t, err, ErrKeyIDReused)
+	require.Same(t, current, keys.Current())
+
+	loader.current = createObjectTestEdDSAKey(t, "second")
+	loader.previous = []*SigningKey{createObjectTestEdDSAKey(t, "first")}
+
+	_, err = keys.Reload()
+	require.ErrorIs(t, err, ErrKeyIDReused)
+	require.Same(t, current, keys.Current())
+
+	loader.previous = []*SigningKey{current}
+
+	rotated, err := keys.Reload()
+	require.NoError(t, err)
+	require.True(t, rotated)
+}
+
+func TestKeyRingHMACKeyIDReused(t *testing.T) {
+	first, err := CreateObjectHMACKey("hmac", "12345")
+	require.NoError(t, err)
+
+	loader := &testKeyLoader{current: first}
+
+	keys, err := CreateObjectKeyRing(loader.load, time.Hour, time.Time{})
+	require.NoError(t, err)
+
+	loader.current, err = CreateObjectHMACKey("hmac", "12345")
+	require.NoError(t, err)
+
+	rotated, err := keys.Reload()
+	require.NoError(t, err)
+	require.False(t, rotated)
+
+	loader.current, err = CreateObjectHMACKey("hmac", "54321")
+	require.NoError(t, err)
+
+	_, err = keys.Reload()
+	require.ErrorIs(t, err, ErrKeyIDReused)
+	require.Same(t, first, keys.Current())
+}
+
+func TestCreateObjectHMACKeyID(t *testing.T) {
+	first := createObjectTestHMACKey(t, "12345")
+	second := createObjectTestHMACKey(t, "54321")
+
+	require.NotEmpty(t, first.ID())
+	require.Equal(t, first.ID(), createObjectTestHMACKey(t, "12345").ID())
+	require.NotEqual(t, first.ID(), second.ID())
+}
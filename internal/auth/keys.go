@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	AlgHS512 = "HS512"
+	AlgRS512 = "RS512"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+
+	minRSAKeyBits = 2048
+	hmacKeyIDSize = 12
+)
+
+var ErrInvalidSigningKey = errors.New("invalid signing key")
+
+// SigningKey is a key used to sign access tokens together with its kid and the key that verifies them.
+type SigningKey struct {
+	id        string
+	algorithm string
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *SigningKey) ID() string {
+	return k.id
+}
+
+func (k *SigningKey) Algorithm() string {
+	return k.algorithm
+}
+
+// sameMaterial reports whether other verifies with the same algorithm and key as k.
+func (k *SigningKey) sameMaterial(other *SigningKey) bool {
+	if k.algorithm != other.algorithm {
+		return false
+	}
+
+	switch verifyKey := k.verifyKey.(type) {
+	case []byte:
+		otherKey, ok := other.verifyKey.([]byte)
+		return ok && hmac.Equal(verifyKey, otherKey)
+	case interface{ Equal(crypto.PublicKey) bool }:
+		return verifyKey.Equal(other.verifyKey)
+	default:
+		return false
+	}
+}
+
+// CreateObjectHMACKey creates an HS512 key. An empty keyID is derived from the secret
+// with HMAC, so the kid identifies the key without revealing anything about it.
+func CreateObjectHMACKey(keyID string, secret string) (*SigningKey, error) {
+	const op = "auth.CreateObjectHMACKey"
+
+	if secret == "" {
+		return nil, fmt.Errorf("%s: %w: empty secret", op, ErrInvalidSigningKey)
+	}
+
+	if keyID == "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("kid"))
+		keyID = encodeBase64(mac.Sum(nil)[:hmacKeyIDSize])
+	}
+
+	return &SigningKey{
+		id:        keyID,
+		algorithm: AlgHS512,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}, nil
+}
+
+// LoadSigningKey reads a PEM encoded private key for RS512, ES512 or EdDSA.
+// An empty keyID is replaced with the RFC 7638 thumbprint of the public key,
+// an empty algorithm is taken from the key type.
+func LoadSigningKey(algorithm string, keyID string, path string) (*SigningKey, error) {
+	const op = "auth.LoadSigningKey"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := ParseSigningKey(algorithm, keyID, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+func ParseSigningKey(algorithm string, keyID string, data []byte) (*SigningKey, error) {
+	const op = "auth.ParseSigningKey"
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: %w: no PEM block found", op, ErrInvalidSigningKey)
+	}
+
+	privateKey, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidSigningKey, err)
+	}
+
+	key := &SigningKey{
+		id:      keyID,
+		signKey: privateKey,
+	}
+
+	if algorithm == "" {
+		algorithm = algorithmFor(privateKey)
+	}
+
+	switch algorithm {
+	case AlgRS512:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: %s needs an RSA key", op, ErrInvalidSigningKey, algorithm)
+		}
+
+		if rsaKey.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%s: %w: RSA key is shorter than %d bits", op, ErrInvalidSigningKey, minRSAKeyBits)
+		}
+
+		key.algorithm = AlgRS512
+		key.verifyKey = &rsaKey.PublicKey
+	case AlgES512:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P521() {
+			return nil, fmt.Errorf("%s: %w: %s needs a P-521 key", op, ErrInvalidSigningKey, algorithm)
+		}
+
+		key.algorithm = AlgES512
+		key.verifyKey = &ecKey.PublicKey
+	case AlgEdDSA:
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w: %s needs an Ed25519 key", op, ErrInvalidSigningKey, algorithm)
+		}
+
+		key.algorithm = AlgEdDSA
+		key.verifyKey = edKey.Public()
+	default:
+		return nil, fmt.Errorf("%s: %w: unsupported algorithm %q", op, ErrInvalidSigningKey, algorithm)
+	}
+
+	if key.id == "" {
+		jwk, err := key.JWK()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		key.id = jwk.Thumbprint()
+	}
+
+	return key, nil
+}
+
+func algorithmFor(privateKey crypto.PrivateKey) string {
+	switch privateKey.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS512
+	case *ecdsa.PrivateKey:
+		return AlgES512
+	case ed25519.PrivateKey:
+		return AlgEdDSA
+	default:
+		return ""
+	}
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
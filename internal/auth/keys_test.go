@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeTestPrivateKey(t *testing.T, privateKey crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func createObjectTestPrivateKey(t *testing.T, algorithm string) crypto.PrivateKey {
+	switch algorithm {
+	case AlgRS512:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		return key
+	case AlgES512:
+		key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+		require.NoError(t, err)
+		return key
+	default:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		return key
+	}
+}
+
+func decodeTestSegment(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+
+	return b
+}
+
+// publicKeyFromJWK rebuilds the public key the way a downstream service would.
+func publicKeyFromJWK(t *testing.T, jwk JWK) interface{} {
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decodeTestSegment(t, jwk.N)),
+			E: int(new(big.Int).SetBytes(decodeTestSegment(t, jwk.E)).Int64()),
+		}
+	case "EC":
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P521(),
+			X:     new(big.Int).SetBytes(decodeTestSegment(t, jwk.X)),
+			Y:     new(big.Int).SetBytes(decodeTestSegment(t, jwk.Y)),
+		}
+	default:
+		return ed25519.PublicKey(decodeTestSegment(t, jwk.X))
+	}
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	for _, algorithm := range []string{AlgRS512, AlgES512, AlgEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := ParseSigningKey(algorithm, "", encodeTestPrivateKey(t, createObjectTestPrivateKey(t, algorithm)))
+			require.NoError(t, err)
+			require.NotEmpty(t, key.ID())
+
+			m, err := CreateObjectWithKey(key, "67890")
+			require.NoError(t, err)
+
+			accessToken, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+			require.NoError(t, err)
+
+			claims, err := m.ParseJWT(accessToken)
+			require.NoError(t, err)
+			require.Equal(t, "data", claims.Subject)
+
+			jwks := m.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, key.ID(), jwks.Keys[0].Kid)
+			require.Equal(t, algorithm, jwks.Keys[0].Alg)
+			require.Equal(t, key.ID(), jwks.Keys[0].Thumbprint())
+
+			token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+				require.Equal(t, key.ID(), token.Header["kid"])
+				return publicKeyFromJWK(t, jwks.Keys[0]), nil
+			})
+			require.NoError(t, err)
+			require.True(t, token.Valid)
+		})
+	}
+}
+
+func TestParseSigningKeyError(t *testing.T) {
+	_, err := ParseSigningKey(AlgRS512, "", []byte("not a pem"))
+	require.ErrorIs(t, err, ErrInvalidSigningKey)
+
+	_, err = ParseSigningKey(AlgRS512, "", encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)))
+	require.ErrorIs(t, err, ErrInvalidSigningKey)
+
+	_, err = ParseSigningKey(AlgHS512, "", encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)))
+	require.ErrorIs(t, err, ErrInvalidSigningKey)
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = ParseSigningKey(AlgES512, "", encodeTestPrivateKey(t, p256))
+	require.ErrorIs(t, err, ErrInvalidSigningKey)
+
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, err = ParseSigningKey(AlgRS512, "", encodeTestPrivateKey(t, short))
+	require.ErrorIs(t, err, ErrInvalidSigningKey)
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)), 0o600))
+
+	key, err := LoadSigningKey(AlgEdDSA, "key-1", path)
+	require.NoError(t, err)
+	require.Equal(t, "key-1", key.ID())
+	require.Equal(t, AlgEdDSA, key.Algorithm())
+}
+
+func TestParseJWTUnknownKeyID(t *testing.T) {
+	first, err := ParseSigningKey(AlgEdDSA, "first", encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)))
+	require.NoError(t, err)
+
+	second, err := ParseSigningKey(AlgEdDSA, "second", encodeTestPrivateKey(t, createObjectTestPrivateKey(t, AlgEdDSA)))
+	require.NoError(t, err)
+
+	m := Authenticator{keys: CreateObjectStaticKeyRing(first)}
+	other := Authenticator{keys: CreateObjectStaticKeyRing(second)}
+
+	accessToken, err := other.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(accessToken)
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+}
+
+func TestJWKSSymmetricKey(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+
+	require.Empty(t, m.JWKS().Keys)
+}
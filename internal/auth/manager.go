@@ -1,64 +1,323 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"math/rand"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/DarRo9/Test-task-BackDev/pkg/accesstoken"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	refreshTokenIDSize     = 16
+	refreshTokenSecretSize = 32
+	refreshTokenMACSize    = sha256.Size
+	refreshTokenSize       = refreshTokenIDSize + refreshTokenSecretSize + refreshTokenMACSize
+)
+
+var (
+	ErrMalformedToken = errors.New("malformed refresh token")
+	ErrTamperedToken  = errors.New("tampered refresh token")
+	ErrUnknownToken   = errors.New("unknown refresh token")
+
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrExpiredAccessToken = accesstoken.ErrExpired
+)
+
 type Authenticator struct {
-	signingKey string
+	keys            *KeyRing
+	refreshTokenKey []byte
+	issuer          string
+	audience        []string
+	leeway          time.Duration
+	unscopedUntil   time.Time
+	now             func() time.Time
+}
+
+// Validation tunes the checks of registered claims in ParseJWT.
+// With Issuer or Audience set, new access tokens carry iss and aud, and ParseJWT accepts only
+// tokens with this issuer and at least one of the audiences. Tokens with neither iss nor aud,
+// issued before these were configured, are still accepted until UnscopedUntil.
+// Leeway tolerates clock skew between the hosts that issue and verify tokens.
+type Validation struct {
+	Issuer        string
+	Audience      []string
+	UnscopedUntil time.Time
+	Leeway        time.Duration
 }
 
-type IndividualRequirements struct {
-	jwt.StandardClaims
-	GUID string `json:"guid"`
+type RefreshToken struct {
+	ID     string
+	Secret string
 }
 
-func CreateObject(signingKey string) (*Authenticator, error) {
+func CreateObject(signingKey string, refreshTokenKey string) (*Authenticator, error) {
 	const op = "auth.Authenticator.CreateObjectAuthenticator"
 
 	if signingKey == "" {
 		return nil, fmt.Errorf("%s: %w", op, errors.New("empty signingKey"))
 	}
 
-	return &Authenticator{signingKey: signingKey}, nil
+	key, err := CreateObjectHMACKey("", signingKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return CreateObjectWithKey(key, refreshTokenKey)
+}
+
+func CreateObjectWithKey(signingKey *SigningKey, refreshTokenKey string) (*Authenticator, error) {
+	const op = "auth.Authenticator.CreateObjectWithKey"
+
+	if signingKey == nil {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("empty signingKey"))
+	}
+
+	return CreateObjectWithKeyRing(CreateObjectStaticKeyRing(signingKey), refreshTokenKey, Validation{})
+}
+
+func CreateObjectWithKeyRing(keys *KeyRing, refreshTokenKey string, validation Validation) (*Authenticator, error) {
+	const op = "auth.Authenticator.CreateObjectWithKeyRing"
+
+	if keys == nil {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("empty keys"))
+	}
+
+	if refreshTokenKey == "" {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("empty refreshTokenKey"))
+	}
+
+	if validation.Leeway < 0 {
+		return nil, fmt.Errorf("%s: %w", op, errors.New("negative leeway"))
+	}
+
+	return &Authenticator{
+		keys:            keys,
+		refreshTokenKey: []byte(refreshTokenKey),
+		issuer:          validation.Issuer,
+		audience:        validation.Audience,
+		leeway:          validation.Leeway,
+		unscopedUntil:   validation.UnscopedUntil,
+		now:             time.Now,
+	}, nil
+}
+
+func (m *Authenticator) CreateObjectJWT(data string, pairID string, ip string, ttl time.Duration) (string, error) {
+	return m.CreateObjectJWTWithClaims(data, pairID, ip, ttl, nil)
 }
 
-func (m *Authenticator) CreateObjectJWT(data string, ttl time.Duration) (string, error) {
-	guid := uuid.New().String()
+// CreateObjectJWTWithClaims adds custom claims to the token. Custom claims named like
+// registered ones, guid or ip are dropped.
+func (m *Authenticator) CreateObjectJWTWithClaims(data string, pairID string, ip string, ttl time.Duration, custom map[string]interface{}) (string, error) {
+	const op = "auth.Authenticator.CreateObjectJWTWithClaims"
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
 
 	claims := IndividualRequirements{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(ttl).Unix(),
+		Claims: Claims{
+			Issuer:    m.issuer,
 			Subject:   data,
+			Audience:  m.audience,
+			ExpiresAt: now.Add(ttl).Unix(),
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+			ID:        id.String(),
 		},
-		GUID: guid,
+		GUID:   pairID,
+		IP:     ip,
+		Custom: custom,
+	}
+
+	accessToken, err := codec.sign(&claims, m.keys.Current())
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accessToken, nil
+}
+
+// JWKS publishes the public keys of the ring. HS512 keys are never published.
+func (m *Authenticator) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range m.keys.Keys() {
+		if jwk, err := key.JWK(); err == nil {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+// ReloadKeys reloads the key ring and reports whether the signing key has changed.
+func (m *Authenticator) ReloadKeys() (bool, error) {
+	const op = "auth.Authenticator.ReloadKeys"
+
+	rotated, err := m.keys.Reload()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rotated, nil
+}
+
+// ParseJWT verifies signature, algorithm, expiry and, when configured, issuer and audience of an access token.
+func (m *Authenticator) ParseJWT(accessToken string) (*IndividualRequirements, error) {
+	const op = "auth.Authenticator.ParseJWT"
+
+	claims, err := m.parseJWT(accessToken, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	return claims, nil
+}
+
+// GetPairID accepts expired access tokens, since they are exchanged on refresh.
+func (m *Authenticator) GetPairID(accessToken string, data string) (string, error) {
+	const op = "auth.Authenticator.GetPairID"
+
+	claims, err := m.parseJWT(accessToken, true)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if claims.Subject != data {
+		return "", fmt.Errorf("%s: %w", op, errors.New("subject mismatch"))
+	}
+
+	if claims.GUID == "" {
+		return "", fmt.Errorf("%s: %w", op, errors.New("empty guid"))
+	}
 
-	return token.SignedString([]byte(m.signingKey))
+	return claims.GUID, nil
 }
 
+func (m *Authenticator) parseJWT(accessToken string, skipClaimsValidation bool) (*IndividualRequirements, error) {
+	var claims IndividualRequirements
+
+	options := parseOptions{
+		algorithms:           m.keys.algorithms(),
+		issuer:               m.issuer,
+		audience:             m.audience,
+		leeway:               m.leeway,
+		skipClaimsValidation: skipClaimsValidation,
+		key:                  m.verificationKey,
+	}
+
+	err := codec.parse(accessToken, &claims, options)
+	if errors.Is(err, ErrInvalidAccessToken) && m.acceptsUnscoped() {
+		return m.parseUnscopedJWT(accessToken, options, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (m *Authenticator) acceptsUnscoped() bool {
+	return (m.issuer != "" || len(m.audience) > 0) && m.now().Before(m.unscopedUntil)
+}
+
+// parseUnscopedJWT accepts a token that fails only because it has neither iss nor aud.
+// Otherwise it returns scopedErr from the check against the configured issuer and audience.
+func (m *Authenticator) parseUnscopedJWT(accessToken string, options parseOptions, scopedErr error) (*IndividualRequirements, error) {
+	var claims IndividualRequirements
+
+	options.issuer, options.audience = "", nil
+
+	if err := codec.parse(accessToken, &claims, options); err != nil {
+		return nil, scopedErr
+	}
+
+	if claims.Issuer != "" || len(claims.Audience) > 0 {
+		return nil, scopedErr
+	}
+
+	return &claims, nil
+}
+
+// verificationKey picks the key by kid. Tokens without kid were issued before
+// key rotation existed and are checked against the current key.
+func (m *Authenticator) verificationKey(keyID string, algorithm string) (interface{}, error) {
+	key := m.keys.Current()
+
+	if keyID != "" {
+		var ok bool
+		if key, ok = m.keys.Lookup(keyID); !ok {
+			return nil, fmt.Errorf("unknown kid %q", keyID)
+		}
+	}
+
+	if algorithm != key.Algorithm() {
+		return nil, fmt.Errorf("kid %q does not sign with %s", key.ID(), algorithm)
+	}
+
+	return key.verifyKey, nil
+}
+
+// CreateObjectRefreshToken returns base64url(id | secret | HMAC-SHA256(id | secret)).
 func (m *Authenticator) CreateObjectRefreshToken() (string, error) {
 	const op = "auth.Authenticator.CreateObjectRefreshToken"
 
-	b := make([]byte, 32)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
-	s := rand.NewSource(time.Now().Unix())
-	r := rand.New(s)
+	b := make([]byte, refreshTokenIDSize+refreshTokenSecretSize, refreshTokenSize)
+	copy(b, id[:])
 
-	if _, err := r.Read(b); err != nil {
+	if _, err := rand.Read(b[refreshTokenIDSize:]); err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	return fmt.Sprintf("%x", b), nil
+	b = append(b, m.signRefreshToken(b)...)
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (m *Authenticator) ParseRefreshToken(token string) (RefreshToken, error) {
+	const op = "auth.Authenticator.ParseRefreshToken"
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != refreshTokenSize {
+		return RefreshToken{}, fmt.Errorf("%s: %w", op, ErrMalformedToken)
+	}
+
+	payload, mac := b[:refreshTokenIDSize+refreshTokenSecretSize], b[refreshTokenIDSize+refreshTokenSecretSize:]
+	if !hmac.Equal(mac, m.signRefreshToken(payload)) {
+		return RefreshToken{}, fmt.Errorf("%s: %w", op, ErrTamperedToken)
+	}
+
+	id, err := uuid.FromBytes(payload[:refreshTokenIDSize])
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("%s: %w", op, ErrMalformedToken)
+	}
+
+	return RefreshToken{
+		ID:     id.String(),
+		Secret: base64.RawURLEncoding.EncodeToString(payload[refreshTokenIDSize:]),
+	}, nil
+}
+
+func (m *Authenticator) signRefreshToken(payload []byte) []byte {
+	mac := hmac.New(sha256.New, m.refreshTokenKey)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
 }
 
 func (m *Authenticator) HashToken(token string) ([]byte, error) {
@@ -1,36 +1,175 @@
 package auth
 
 import (
+	"encoding/base64"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/require"
 )
 
+func createObjectTestHMACKey(t *testing.T, secret string) *SigningKey {
+	key, err := CreateObjectHMACKey("", secret)
+	require.NoError(t, err)
+
+	return key
+}
+
 func TestCreateObjectAuthenticator(t *testing.T) {
 	signingKey := "12345"
+	refreshTokenKey := "67890"
 
-	_, err := CreateObject(signingKey)
+	_, err := CreateObject(signingKey, refreshTokenKey)
 	require.NoError(t, err)
 }
 
 func TestCreateObjectAuthenticatorError(t *testing.T) {
 	signingKey := ""
+	refreshTokenKey := "67890"
 
-	_, err := CreateObject(signingKey)
+	_, err := CreateObject(signingKey, refreshTokenKey)
+	require.Error(t, err)
+
+	_, err = CreateObject("12345", "")
 	require.Error(t, err)
 }
 
 func TestCreateObjectJWT(t *testing.T) {
-	m := Authenticator{}
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
 	data := "data"
 	ttl := time.Duration(time.Duration.Hours(5))
 
-	jwt, err := m.CreateObjectJWT(data, ttl)
+	jwt, err := m.CreateObjectJWT(data, "pair", "127.0.0.1", ttl)
 	require.NoError(t, err)
 	require.NotEmpty(t, jwt)
 }
 
+func TestParseJWT(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+
+	token, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	claims, err := m.ParseJWT(token)
+	require.NoError(t, err)
+	require.Equal(t, "data", claims.Subject)
+	require.Equal(t, "pair", claims.GUID)
+	require.Equal(t, "127.0.0.1", claims.IP)
+}
+
+func TestParseJWTExpired(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+
+	token, err := m.CreateObjectJWT("data", "pair", "127.0.0.1", -time.Minute)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(token)
+	require.ErrorIs(t, err, ErrExpiredAccessToken)
+}
+
+func TestParseJWTAlgorithm(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+
+	claims := IndividualRequirements{
+		Claims: Claims{ExpiresAt: time.Now().Add(time.Minute).Unix(), Subject: "data"},
+		GUID:   "pair",
+	}
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims{&claims}).SignedString([]byte("12345"))
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(hs256)
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwtClaims{&claims}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = m.ParseJWT(none)
+	require.ErrorIs(t, err, ErrInvalidAccessToken)
+}
+
+func TestGetPairID(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+	data := "data"
+	pairID := "f47ac10b-58cc-4372-a567-0e02b2c3d479"
+
+	jwt, err := m.CreateObjectJWT(data, pairID, "127.0.0.1", -time.Minute)
+	require.NoError(t, err)
+
+	got, err := m.GetPairID(jwt, data)
+	require.NoError(t, err)
+	require.Equal(t, pairID, got)
+}
+
+func TestGetPairIDError(t *testing.T) {
+	m := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "12345"))}
+	other := Authenticator{keys: CreateObjectStaticKeyRing(createObjectTestHMACKey(t, "54321"))}
+
+	jwt, err := other.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	_, err = m.GetPairID(jwt, "data")
+	require.Error(t, err)
+
+	jwt, err = m.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	_, err = m.GetPairID(jwt, "another")
+	require.Error(t, err)
+}
+
+func TestCreateObjectRefreshToken(t *testing.T) {
+	m := Authenticator{refreshTokenKey: []byte("67890")}
+
+	first, err := m.CreateObjectRefreshToken()
+	require.NoError(t, err)
+
+	second, err := m.CreateObjectRefreshToken()
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	_, err = base64.RawURLEncoding.DecodeString(first)
+	require.NoError(t, err)
+
+	firstParsed, err := m.ParseRefreshToken(first)
+	require.NoError(t, err)
+
+	secondParsed, err := m.ParseRefreshToken(second)
+	require.NoError(t, err)
+	require.NotEqual(t, firstParsed.ID, secondParsed.ID)
+	require.NotEmpty(t, firstParsed.Secret)
+}
+
+func TestParseRefreshTokenMalformed(t *testing.T) {
+	m := Authenticator{refreshTokenKey: []byte("67890")}
+
+	_, err := m.ParseRefreshToken("4373fbac63c46617971af8e9127cc69dcb8981e3f9b285b08f0b76c6501f7256")
+	require.ErrorIs(t, err, ErrMalformedToken)
+
+	_, err = m.ParseRefreshToken("not base64!")
+	require.ErrorIs(t, err, ErrMalformedToken)
+}
+
+func TestParseRefreshTokenTampered(t *testing.T) {
+	m := Authenticator{refreshTokenKey: []byte("67890")}
+
+	token, err := m.CreateObjectRefreshToken()
+	require.NoError(t, err)
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	require.NoError(t, err)
+	b[refreshTokenIDSize] ^= 0xff
+
+	_, err = m.ParseRefreshToken(base64.RawURLEncoding.EncodeToString(b))
+	require.ErrorIs(t, err, ErrTamperedToken)
+
+	other := Authenticator{refreshTokenKey: []byte("other")}
+
+	_, err = other.ParseRefreshToken(token)
+	require.ErrorIs(t, err, ErrTamperedToken)
+}
+
 func TestHashToken(t *testing.T) {
 	m := Authenticator{}
 	token := "4373fbac63c46617971af8e9127cc69dcb8981e3f9b285b08f0b76c6501f7256"
@@ -1,23 +1,108 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// HTTPServer.LegacyNameHeader defaults to false: cleanenv applies env-default to zero values,
+// so with a true default "legacy_name_header: false" in a config file would be ignored.
+// Requests that still use the header get Deprecation and Warning headers and a warning in the log.
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8080"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address          string         `yaml:"address" env-default:"localhost:8080"`
+	Timeout          time.Duration  `yaml:"timeout" env-default:"4s"`
+	IdleTimeout      time.Duration  `yaml:"idle_timeout" env-default:"60s"`
+	TrustedProxies   []string       `yaml:"trusted_proxies"`
+	TrustedNets      []netip.Prefix `yaml:"-"`
+	LegacyNameHeader bool           `yaml:"legacy_name_header" env-default:"false"`
 }
 
 type JWT struct {
-	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
-	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
-	SigningKey      string
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"`
+	Algorithm        string        `yaml:"algorithm" env-default:"HS512"`
+	Issuer           string        `yaml:"issuer"`
+	Audience         []string      `yaml:"audience"`
+	PrivateKeyPath   string        `yaml:"private_key_path"`
+	KeyID            string        `yaml:"key_id"`
+	PreviousKeyPaths []string      `yaml:"previous_key_paths"`
+	KeyGracePeriod   time.Duration `yaml:"key_grace_period" env-default:"1h"`
+	Leeway           time.Duration `yaml:"leeway" env-default:"5s"`
+	PreviousNotAfter time.Time     `yaml:"previous_keys_not_after"`
+	SigningKey       string
+	PreviousKeys     []string
+	RefreshTokenKey  string
+}
+
+type Admin struct {
+	Token string
+}
+
+const (
+	EvictionOldest = "oldest"
+	EvictionReject = "reject"
+)
+
+// Sessions limits the open sessions of a user. cleanenv replaces a zero max_per_user
+// with the default, so a negative value is used for no limit.
+type Sessions struct {
+	MaxPerUser     int    `yaml:"max_per_user" env-default:"5"`
+	Eviction       string `yaml:"eviction" env-default:"oldest"`
+	RejectIPChange bool   `yaml:"reject_ip_change" env-default:"false"`
+}
+
+const (
+	RefreshSourceCookie = "cookie"
+	RefreshSourceBody   = "body"
+	RefreshSourceHeader = "header"
+)
+
+type Cookie struct {
+	Name       string `yaml:"name" env-default:"refresh_token"`
+	Path       string `yaml:"path" env-default:"/"`
+	Domain     string `yaml:"domain"`
+	Secure     bool   `yaml:"secure" env-default:"false"`
+	SameSite   string `yaml:"same_site" env-default:"lax"`
+	CSRFName   string `yaml:"csrf_name" env-default:"csrf_token"`
+	CSRFHeader string `yaml:"csrf_header" env-default:"X-CSRF-Token"`
+}
+
+type Refresh struct {
+	Sources []string `yaml:"sources" env-default:"cookie,body,header"`
+	Cookie  Cookie   `yaml:"cookie"`
+}
+
+const (
+	DriverMongo    = "mongodb"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+type Postgres struct {
+	URI             string        `yaml:"-"`
+	MaxConns        int32         `yaml:"max_conns" env-default:"10"`
+	MinConns        int32         `yaml:"min_conns" env-default:"0"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime" env-default:"1h"`
+}
+
+// StorageTimeouts bound every storage call. cleanenv replaces a zero timeout
+// with the default, so a negative value is used to disable it.
+type StorageTimeouts struct {
+	Read  time.Duration `yaml:"read" env-default:"2s"`
+	Write time.Duration `yaml:"write" env-default:"3s"`
+}
+
+type Storage struct {
+	Driver   string          `yaml:"driver" env-default:"mongodb"`
+	Postgres Postgres        `yaml:"postgres"`
+	Timeouts StorageTimeouts `yaml:"timeouts"`
 }
 
 type Mongo struct {
@@ -28,11 +113,57 @@ type Mongo struct {
 	Database string
 }
 
+type SMTP struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+// Notifier.Retries is the number of attempts after the first one. cleanenv replaces
+// a zero with the default, so a negative value is used for a single attempt.
+type Notifier struct {
+	Driver     string        `yaml:"driver" env-default:"noop"`
+	OutboxPath string        `yaml:"outbox_path" env-default:"outbox.jsonl"`
+	QueueSize  int           `yaml:"queue_size" env-default:"100"`
+	Retries    int           `yaml:"retries" env-default:"3"`
+	RetryDelay time.Duration `yaml:"retry_delay" env-default:"1s"`
+	Timeout    time.Duration `yaml:"timeout" env-default:"10s"`
+	SMTP       SMTP          `yaml:"-"`
+}
+
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// Tracing selects where spans are exported. An empty endpoint falls back to the OTEL_EXPORTER_OTLP_* variables.
+type Tracing struct {
+	Exporter    string `yaml:"exporter" env-default:"none"`
+	Endpoint    string `yaml:"endpoint"`
+	Insecure    bool   `yaml:"insecure" env-default:"false"`
+	ServiceName string `yaml:"service_name" env-default:"auth-service"`
+}
+
+// Metrics serves /metrics on its own listener, so it is not reachable through the public address.
+type Metrics struct {
+	Address string `yaml:"address" env-default:"localhost:9090"`
+}
+
 type Config struct {
 	Env        string `yaml:"env" env-default:"local"`
 	HTTPServer `yaml:"http_server"`
 	Mongo
-	JWT `yaml:"jwt"`
+	Storage  Storage `yaml:"storage"`
+	JWT      `yaml:"jwt"`
+	Sessions Sessions `yaml:"sessions"`
+	Refresh  Refresh  `yaml:"refresh"`
+	Notifier Notifier `yaml:"notifier"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Metrics  Metrics  `yaml:"metrics"`
+	Admin    Admin    `yaml:"-"`
 }
 
 func MakeEnvSettings(config *Config) {
@@ -44,7 +175,64 @@ func MakeEnvSettings(config *Config) {
 
 	config.Mongo.Database = os.Getenv("MONGO_DATABASE")
 
+	config.Storage.Postgres.URI = os.Getenv("POSTGRES_URI")
+
 	config.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
+
+	if privateKeyPath := os.Getenv("JWT_PRIVATE_KEY_PATH"); privateKeyPath != "" {
+		config.JWT.PrivateKeyPath = privateKeyPath
+	}
+
+	config.JWT.PreviousKeys = nil
+	for _, key := range strings.Split(os.Getenv("JWT_PREVIOUS_SIGNING_KEYS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.JWT.PreviousKeys = append(config.JWT.PreviousKeys, key)
+		}
+	}
+
+	config.Admin.Token = os.Getenv("ADMIN_TOKEN")
+
+	config.JWT.RefreshTokenKey = os.Getenv("REFRESH_TOKEN_KEY")
+
+	config.Notifier.SMTP.Host = os.Getenv("SMTP_HOST")
+	config.Notifier.SMTP.Port = os.Getenv("SMTP_PORT")
+	config.Notifier.SMTP.User = os.Getenv("SMTP_USER")
+	config.Notifier.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	config.Notifier.SMTP.From = os.Getenv("SMTP_FROM")
+}
+
+// placeholderSecrets are the secrets config.env ships with. They are only fit for a local run.
+var placeholderSecrets = []string{"local", "local-refresh"}
+
+func IsPlaceholderSecret(secret string) bool {
+	return slices.Contains(placeholderSecrets, secret)
+}
+
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	const op = "config.ParseTrustedProxies"
+
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
 }
 
 func Loading() *Config {
@@ -65,5 +253,45 @@ func Loading() *Config {
 
 	MakeEnvSettings(&config)
 
+	switch config.Storage.Driver {
+	case DriverMongo, DriverPostgres, DriverMemory:
+	default:
+		log.Fatalf("unknown storage driver: %s", config.Storage.Driver)
+	}
+
+	if config.Sessions.Eviction != EvictionOldest && config.Sessions.Eviction != EvictionReject {
+		log.Fatalf("unknown sessions eviction policy: %s", config.Sessions.Eviction)
+	}
+
+	if config.JWT.RefreshTokenKey == "" {
+		log.Fatal("REFRESH_TOKEN_KEY is not set")
+	}
+
+	if config.JWT.RefreshTokenKey == config.JWT.SigningKey || slices.Contains(config.JWT.PreviousKeys, config.JWT.RefreshTokenKey) {
+		log.Fatal("REFRESH_TOKEN_KEY must differ from the JWT signing keys")
+	}
+
+	if config.JWT.KeyGracePeriod <= config.JWT.AccessTokenTTL+config.JWT.Leeway {
+		log.Fatalf("jwt key_grace_period %s must be longer than access_token_ttl %s plus leeway %s", config.JWT.KeyGracePeriod, config.JWT.AccessTokenTTL, config.JWT.Leeway)
+	}
+
+	for _, source := range config.Refresh.Sources {
+		if source != RefreshSourceCookie && source != RefreshSourceBody && source != RefreshSourceHeader {
+			log.Fatalf("unknown refresh token source: %s", source)
+		}
+	}
+
+	switch strings.ToLower(config.Refresh.Cookie.SameSite) {
+	case "lax", "strict", "none":
+	default:
+		log.Fatalf("unknown cookie same_site mode: %s", config.Refresh.Cookie.SameSite)
+	}
+
+	trustedNets, err := ParseTrustedProxies(config.HTTPServer.TrustedProxies)
+	if err != nil {
+		log.Fatalf("cannot parse trusted proxies: %s", err)
+	}
+	config.HTTPServer.TrustedNets = trustedNets
+
 	return &config
 }
@@ -3,28 +3,14 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
-	"time"
-)
-
-func setCookies(w http.ResponseWriter, refreshToken string, accessToken string, refreshTokenTTL time.Duration, accessTokenTTL time.Duration) {
-	httpOnlyCookie := http.Cookie{
-		Name:     "httpOnly_cookie",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(refreshTokenTTL),
-		Path:     "/api/auth",
-		HttpOnly: true,
-	}
-	http.SetCookie(w, &httpOnlyCookie)
+	"net/netip"
+	"strings"
 
-	regularCookie := http.Cookie{
-		Name:    "regular_cookie",
-		Value:   accessToken,
-		Expires: time.Now().Add(accessTokenTTL),
-		Path:    "/api/auth",
-	}
-	http.SetCookie(w, &regularCookie)
-}
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/logger"
+	"github.com/google/uuid"
+)
 
 func jsonRendering(w http.ResponseWriter, v interface{}) error {
 	const op = "http-server.handler.jsonRendering"
@@ -50,3 +36,103 @@ func getHeader(r *http.Request, header string) (string, error) {
 
 	return h, nil
 }
+
+// getUserGUID returns the canonical form of the ?guid= query parameter.
+// When legacyNameHeader is set, a request without it falls back to the deprecated Name header.
+func getUserGUID(r *http.Request, legacyNameHeader bool) (string, error) {
+	guid := r.URL.Query().Get(guidParam)
+	if guid == "" {
+		if legacyNameHeader {
+			if userName := r.Header.Get(name); userName != "" {
+				return userName, nil
+			}
+		}
+
+		return "", errMissingGUID
+	}
+
+	userGUID, err := uuid.Parse(guid)
+	if err != nil {
+		return "", errInvalidGUID
+	}
+
+	return userGUID.String(), nil
+}
+
+// deprecateNameHeader tells the client and the request log that the request still uses the Name header.
+func deprecateNameHeader(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Warning", fmt.Sprintf(`299 - "Header '%v' is deprecated, use the '%v' query parameter"`, name, guidParam))
+
+	logger.SetDeprecated(r.Context(), fmt.Sprintf("Header '%v'", name))
+}
+
+func getBearerToken(r *http.Request) (string, error) {
+	h, err := getHeader(r, authorization)
+	if err != nil {
+		return "", err
+	}
+
+	bearerToken, ok := strings.CutPrefix(h, "Bearer ")
+	if !ok || bearerToken == "" {
+		return "", fmt.Errorf("Header '%v' is not a bearer token", authorization)
+	}
+
+	return bearerToken, nil
+}
+
+func getClientIP(r *http.Request, trustedNets []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remoteAddr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+
+	clientIP := remoteAddr.Unmap()
+	if !isTrusted(clientIP, trustedNets) {
+		return clientIP.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(forwardedFor), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+
+		clientIP = addr.Unmap()
+		if !isTrusted(clientIP, trustedNets) {
+			break
+		}
+	}
+
+	return clientIP.String()
+}
+
+func isTrusted(addr netip.Addr, trustedNets []netip.Prefix) bool {
+	for _, prefix := range trustedNets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getDevice(r *http.Request) string {
+	if d := r.Header.Get(device); d != "" {
+		return d
+	}
+
+	return r.UserAgent()
+}
@@ -4,12 +4,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
-func TestjsonRendering(t *testing.T) {
+func TestJSONRendering(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	testData := struct {
@@ -39,7 +40,7 @@ func TestjsonRendering(t *testing.T) {
 	require.Equal(t, response.Message, expectedMessage)
 }
 
-func TestjsonRenderingError(t *testing.T) {
+func TestJSONRenderingError(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	testData := struct {
@@ -83,3 +84,41 @@ func TestGetHeaderError(t *testing.T) {
 	_, err := getHeader(req, missingHeaderName)
 	require.Error(t, err)
 }
+
+func TestGetBearerToken(t *testing.T) {
+	req := httptest.NewRequest("POST", "/refresh", nil)
+	req.Header.Add("Authorization", "Bearer MyToken")
+
+	value, err := getBearerToken(req)
+	require.NoError(t, err)
+	require.Equal(t, value, "MyToken")
+}
+
+func TestGetBearerTokenError(t *testing.T) {
+	req := httptest.NewRequest("POST", "/refresh", nil)
+	req.Header.Add("Authorization", "Basic MyToken")
+
+	_, err := getBearerToken(req)
+	require.Error(t, err)
+}
+
+func TestGetClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/auth", nil)
+	req.RemoteAddr = "203.0.113.7:5555"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+
+	ip := getClientIP(req, nil)
+	require.Equal(t, "203.0.113.7", ip)
+}
+
+func TestGetClientIPTrustedProxy(t *testing.T) {
+	trustedNets := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	req := httptest.NewRequest("GET", "/auth", nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+	req.Header.Add("X-Forwarded-For", "198.51.100.9, 198.51.100.1")
+	req.Header.Add("X-Forwarded-For", "10.0.0.3")
+
+	ip := getClientIP(req, trustedNets)
+	require.Equal(t, "198.51.100.1", ip)
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+)
+
+const (
+	accessCookieName = "regular_cookie"
+	maxBodySize      = 1 << 16
+)
+
+var (
+	errMissingRefreshToken = errors.New("refresh token is missing")
+	errInvalidBody         = errors.New("request body is not valid JSON")
+	errCSRFMismatch        = errors.New("CSRF token is missing or does not match")
+)
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// getRefreshToken takes the refresh token from the first configured source that has one.
+// A token from the cookie is accepted only together with a matching double-submit CSRF token.
+func (h *Handler) getRefreshToken(r *http.Request) (string, error) {
+	for _, source := range h.config.Refresh.Sources {
+		var refreshToken string
+
+		switch source {
+		case config.RefreshSourceCookie:
+			if cookie, err := r.Cookie(h.config.Refresh.Cookie.Name); err == nil {
+				refreshToken = cookie.Value
+			}
+
+			if refreshToken != "" && !h.validCSRF(r) {
+				return "", errCSRFMismatch
+			}
+		case config.RefreshSourceBody:
+			var err error
+
+			refreshToken, err = getBodyRefreshToken(r)
+			if err != nil {
+				return "", err
+			}
+		case config.RefreshSourceHeader:
+			refreshToken = r.Header.Get(token)
+		}
+
+		if refreshToken != "" {
+			return refreshToken, nil
+		}
+	}
+
+	return "", errMissingRefreshToken
+}
+
+func (h *Handler) requireRefreshToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	refreshToken, err := h.getRefreshToken(r)
+	switch {
+	case errors.Is(err, errCSRFMismatch):
+		httperr.Write(w, r, http.StatusForbidden, codeCSRFMismatch, err.Error())
+		return "", false
+	case errors.Is(err, errInvalidBody):
+		httperr.Write(w, r, http.StatusBadRequest, codeInvalidBody, err.Error())
+		return "", false
+	case err != nil:
+		httperr.Write(w, r, http.StatusBadRequest, codeMissingRefreshToken, err.Error())
+		return "", false
+	}
+
+	return refreshToken, true
+}
+
+func getBodyRefreshToken(r *http.Request) (string, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return "", nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return "", nil
+	}
+
+	var body refreshTokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidBody, err)
+	}
+
+	return body.RefreshToken, nil
+}
+
+func (h *Handler) validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(h.config.Refresh.Cookie.CSRFName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(h.config.Refresh.Cookie.CSRFHeader)
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+// setCookies stores the refresh token in an HttpOnly cookie and issues a fresh CSRF token next to it.
+func (h *Handler) setCookies(w http.ResponseWriter, refreshToken string, accessToken string) error {
+	const op = "http-server.handler.setCookies"
+
+	csrfToken, err := createObjectCSRFToken()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	http.SetCookie(w, h.cookie(h.config.Refresh.Cookie.Name, refreshToken, now.Add(h.config.RefreshTokenTTL), true))
+	http.SetCookie(w, h.cookie(h.config.Refresh.Cookie.CSRFName, csrfToken, now.Add(h.config.RefreshTokenTTL), false))
+	http.SetCookie(w, h.cookie(accessCookieName, accessToken, now.Add(h.config.AccessTokenTTL), false))
+
+	w.Header().Set(h.config.Refresh.Cookie.CSRFHeader, csrfToken)
+
+	return nil
+}
+
+func (h *Handler) clearCookies(w http.ResponseWriter) {
+	for _, name := range []string{h.config.Refresh.Cookie.Name, h.config.Refresh.Cookie.CSRFName, accessCookieName} {
+		cookie := h.cookie(name, "", time.Unix(0, 0), name == h.config.Refresh.Cookie.Name)
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+func (h *Handler) cookie(name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	cookieConfig := h.config.Refresh.Cookie
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expires,
+		Path:     cookieConfig.Path,
+		Domain:   cookieConfig.Domain,
+		Secure:   cookieConfig.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(cookieConfig.SameSite),
+	}
+}
+
+func sameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func createObjectCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
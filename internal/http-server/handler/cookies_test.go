@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/stretchr/testify/require"
+)
+
+func createObjectRefreshRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/refresh?guid="+testGUID, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer access")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req
+}
+
+func TestRefreshTokenSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		token   string
+	}{
+		{"cookie first", []string{config.RefreshSourceCookie, config.RefreshSourceBody, config.RefreshSourceHeader}, "from-cookie"},
+		{"body first", []string{config.RefreshSourceBody, config.RefreshSourceHeader, config.RefreshSourceCookie}, "from-body"},
+		{"header first", []string{config.RefreshSourceHeader, config.RefreshSourceCookie}, "from-header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createObjectTestConfig()
+			cfg.Refresh.Sources = tt.sources
+
+			req := createObjectRefreshRequest(`{"refresh_token":"from-body"}`)
+			req.Header.Set("Token", "from-header")
+			req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "from-cookie"})
+			req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+			req.Header.Set("X-CSRF-Token", "csrf")
+			w := httptest.NewRecorder()
+
+			a := &fakeAuth{}
+			createObjectTestHandlerWithConfig(cfg, a).ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.token, a.refreshToken)
+		})
+	}
+}
+
+func TestRefreshTokenCookieCSRF(t *testing.T) {
+	for _, csrfHeader := range []string{"", "other"} {
+		req := createObjectRefreshRequest("")
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "from-cookie"})
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		if csrfHeader != "" {
+			req.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		w := httptest.NewRecorder()
+
+		a := &fakeAuth{}
+		createObjectTestHandler(a).ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.Empty(t, a.refreshToken)
+
+		var response httperr.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Equal(t, codeCSRFMismatch, response.Error.Code)
+	}
+}
+
+func TestRefreshTokenInvalidBody(t *testing.T) {
+	req := createObjectRefreshRequest(`{"refresh_token":`)
+	w := httptest.NewRecorder()
+
+	createObjectTestHandler(&fakeAuth{}).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response httperr.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, codeInvalidBody, response.Error.Code)
+}
+
+func TestSetCookies(t *testing.T) {
+	cfg := createObjectTestConfig()
+	cfg.Refresh.Cookie.Domain = "example.com"
+
+	req := httptest.NewRequest(http.MethodGet, "/auth?guid="+testGUID, nil)
+	w := httptest.NewRecorder()
+
+	createObjectTestHandlerWithConfig(cfg, &fakeAuth{}).ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	refreshCookie := cookies["refresh_token"]
+	require.NotNil(t, refreshCookie)
+	require.Equal(t, "refresh", refreshCookie.Value)
+	require.Equal(t, "/", refreshCookie.Path)
+	require.Equal(t, "example.com", refreshCookie.Domain)
+	require.True(t, refreshCookie.HttpOnly)
+	require.True(t, refreshCookie.Secure)
+	require.Equal(t, http.SameSiteStrictMode, refreshCookie.SameSite)
+
+	csrfCookie := cookies["csrf_token"]
+	require.NotNil(t, csrfCookie)
+	require.NotEmpty(t, csrfCookie.Value)
+	require.False(t, csrfCookie.HttpOnly)
+	require.Equal(t, csrfCookie.Value, w.Header().Get("X-CSRF-Token"))
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/DarRo9/Test-task-BackDev/internal/service"
+)
+
+const (
+	codeInternal         = "internal_error"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeNotFound         = "not_found"
+	codeMissingHeader    = "missing_header"
+	codeMissingGUID      = "missing_guid"
+	codeInvalidGUID      = "invalid_guid"
+	codeUnauthorized     = "unauthorized"
+
+	codeMissingToken        = "missing_token"
+	codeMissingRefreshToken = "missing_refresh_token"
+	codeInvalidBody         = "invalid_body"
+	codeCSRFMismatch        = "csrf_mismatch"
+)
+
+var (
+	errMissingGUID = errors.New("query parameter 'guid' is missing")
+	errInvalidGUID = errors.New("query parameter 'guid' is not a valid UUID")
+)
+
+type serviceError struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+var serviceErrors = []serviceError{
+	{service.ErrTokenNotFound, http.StatusUnauthorized, "token_not_found", "Refresh token not found"},
+	{service.ErrTokenInvalid, http.StatusUnauthorized, "token_invalid", "Refresh token is invalid"},
+	{service.ErrTokenExpired, http.StatusUnauthorized, "token_expired", "Refresh token has expired"},
+	{service.ErrTokenReused, http.StatusUnauthorized, "token_reused", "Refresh token has been reused, session revoked"},
+	{service.ErrTokenAlreadyRotated, http.StatusConflict, "token_already_rotated", "Refresh token has already been used"},
+	{service.ErrPairMismatch, http.StatusUnauthorized, "token_pair_mismatch", "Access token was not issued with this refresh token"},
+	{service.ErrIPMismatch, http.StatusUnauthorized, "ip_mismatch", "Client IP has changed"},
+	{service.ErrAccessTokenInvalid, http.StatusUnauthorized, "access_token_invalid", "Access token is invalid"},
+	{service.ErrAccessTokenRevoked, http.StatusUnauthorized, "access_token_revoked", "Access token has been revoked"},
+	{service.ErrTooManySessions, http.StatusConflict, "too_many_sessions", "Too many sessions"},
+	{service.ErrStorageUnavailable, http.StatusServiceUnavailable, "storage_unavailable", "Storage is unavailable"},
+}
+
+// writeServiceError maps an error returned by Auth to a status code and a stable error code.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.err) {
+			httperr.Write(w, r, e.status, e.code, e.message)
+			return
+		}
+	}
+
+	httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+}
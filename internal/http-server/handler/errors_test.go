@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+	"github.com/DarRo9/Test-task-BackDev/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteServiceError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("op: %w", service.ErrTokenNotFound), http.StatusUnauthorized, "token_not_found"},
+		{fmt.Errorf("op: %w", service.ErrTokenExpired), http.StatusUnauthorized, "token_expired"},
+		{fmt.Errorf("op: %w", service.ErrTokenReused), http.StatusUnauthorized, "token_reused"},
+		{fmt.Errorf("op: %w", service.ErrIPMismatch), http.StatusUnauthorized, "ip_mismatch"},
+		{fmt.Errorf("op: %w", service.ErrTokenAlreadyRotated), http.StatusConflict, "token_already_rotated"},
+		{fmt.Errorf("op: %w", service.ErrTooManySessions), http.StatusConflict, "too_many_sessions"},
+		{fmt.Errorf("op: %w", service.ErrStorageUnavailable), http.StatusServiceUnavailable, "storage_unavailable"},
+		{errors.New("unexpected"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+		req = req.WithContext(requestid.WithID(req.Context(), "request-1"))
+		w := httptest.NewRecorder()
+
+		writeServiceError(w, req, tt.err)
+
+		require.Equal(t, tt.status, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response httperr.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Equal(t, tt.code, response.Error.Code)
+		require.NotEmpty(t, response.Error.Message)
+		require.Equal(t, "request-1", response.RequestID)
+	}
+}
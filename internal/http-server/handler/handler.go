@@ -1,110 +1,181 @@
 package handler
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
 	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/logger"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+	"github.com/DarRo9/Test-task-BackDev/pkg/authn"
 )
 
 const (
-	name  = "Name"
-	token = "Token"
+	name          = "Name"
+	token         = "Token"
+	authorization = "Authorization"
+	forwardedFor  = "X-Forwarded-For"
+	device        = "Device"
+	tokenParam    = "token"
+	guidParam     = "guid"
 )
 
 type Auth interface {
+	CreateObjectPairID() string
 	RefreshToken(userName string) (string, error)
-	MakeAccessToken(userName string) (string, error)
-	TakeValidToken(refreshToken string, userName string) bool
-	CheckCountTokens(userName string) error
-	InsertToken(refreshToken string, userName string) error
-	SelectToken(CreateObjectToken string, userName string) error
+	MakeAccessToken(ctx context.Context, userName string, pairID string, ip string) (string, error)
+	TakeValidToken(ctx context.Context, refreshToken string, accessToken string, userName string, ip string) error
+	CheckCountTokens(ctx context.Context, userName string) error
+	InsertToken(ctx context.Context, refreshToken string, userName string, pairID string, ip string, device string) error
+	SelectToken(ctx context.Context, oldToken string, CreateObjectToken string, userName string, pairID string, ip string) error
+	ParseAccessToken(ctx context.Context, accessToken string) (*auth.IndividualRequirements, error)
+	Logout(ctx context.Context, refreshToken string, claims *auth.IndividualRequirements) error
+	LogoutAll(ctx context.Context, claims *auth.IndividualRequirements) error
+	JWKS() auth.JWKS
+	ReloadKeys(ctx context.Context) error
 }
 type response struct {
+	GUID         string `json:"guid"`
 	Name         string `json:"user_name"`
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
+type introspectResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	GUID      string `json:"guid,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
 type Handler struct {
-	config *config.Config
-	auth   Auth
-	logger Logger
+	config       *config.Config
+	auth         Auth
+	logger       Logger
+	authenticate Authenticate
+	metrics      Metrics
 }
 
 type Logger func(http.Handler) http.Handler
 
-func CreateObject(config *config.Config, auth Auth, logger Logger) *Handler {
+type Authenticate func(http.Handler) http.Handler
+
+func CreateObject(config *config.Config, auth Auth, logger Logger, authenticate Authenticate, metrics Metrics) *Handler {
 	return &Handler{
-		config: config,
-		auth:   auth,
-		logger: logger,
+		config:       config,
+		auth:         auth,
+		logger:       logger,
+		authenticate: authenticate,
+		metrics:      metrics,
 	}
 }
 
 func (h *Handler) CreateObjectRouter() http.Handler {
 	router := http.NewServeMux()
 
-	authHandler := h.logger(h.authHandler())
+	authHandler := h.instrument("auth", h.logger(h.authHandler()))
 	router.Handle("/auth", authHandler)
 
-	refreshHandler := h.logger(h.refreshHandler())
+	refreshHandler := h.instrument("refresh", h.logger(h.refreshHandler()))
 	router.Handle("/refresh", refreshHandler)
 
-	return router
+	introspectHandler := h.instrument("introspect", h.logger(h.introspectHandler()))
+	router.Handle("/introspect", introspectHandler)
+
+	jwksHandler := h.instrument("jwks", h.logger(h.jwksHandler()))
+	router.Handle("/.well-known/jwks.json", jwksHandler)
+
+	reloadKeysHandler := h.instrument("reload_keys", h.logger(h.reloadKeysHandler()))
+	router.Handle("/admin/keys/reload", reloadKeysHandler)
+
+	logoutHandler := h.instrument("logout", h.logger(h.authenticate(h.logoutHandler())))
+	router.Handle("/logout", logoutHandler)
+
+	logoutAllHandler := h.instrument("logout_all", h.logger(h.authenticate(h.logoutAllHandler())))
+	router.Handle("/logout-all", logoutAllHandler)
+
+	notFoundHandler := h.instrument("not_found", h.logger(h.notFoundHandler()))
+	router.Handle("/", notFoundHandler)
+
+	return requestid.Assign(router)
+}
+
+// notFoundHandler replaces the plain text 404 of ServeMux for paths no route matches.
+func (h *Handler) notFoundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		httperr.Write(w, r, http.StatusNotFound, codeNotFound, "Not Found")
+	}
 }
 
 func (h *Handler) refreshHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "This method is not allowed", http.StatusMethodNotAllowed)
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
 			return
 		}
 
-		refreshTokenFromHeader, err := getHeader(r, token)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Header '%v' is missing", token), http.StatusBadRequest)
+		refreshTokenFromRequest, ok := h.requireRefreshToken(w, r)
+		if !ok {
 			return
 		}
 
-		userName, err := getHeader(r, name)
+		userName, ok := h.requireUserGUID(w, r)
+		if !ok {
+			return
+		}
+
+		accessTokenFromHeader, err := getBearerToken(r)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Header '%v' is missing", name), http.StatusBadRequest)
+			httperr.Write(w, r, http.StatusBadRequest, codeMissingHeader, fmt.Sprintf("Header '%v' is missing", authorization))
 			return
 		}
 
-		if ok := h.auth.TakeValidToken(refreshTokenFromHeader, userName); !ok {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+		ip := getClientIP(r, h.config.TrustedNets)
+
+		if err := h.auth.TakeValidToken(r.Context(), refreshTokenFromRequest, accessTokenFromHeader, userName, ip); err != nil {
+			writeServiceError(w, r, err)
 			return
 		}
 
+		pairID := h.auth.CreateObjectPairID()
+
 		CreateObjectRefreshToken, err := h.auth.RefreshToken(userName)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
 			return
 		}
 
-		if err := h.auth.SelectToken(CreateObjectRefreshToken, userName); err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := h.auth.SelectToken(r.Context(), refreshTokenFromRequest, CreateObjectRefreshToken, userName, pairID, ip); err != nil {
+			writeServiceError(w, r, err)
 			return
 		}
 
-		accessToken, err := h.auth.MakeAccessToken(userName)
+		accessToken, err := h.auth.MakeAccessToken(r.Context(), userName, pairID, ip)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
 			return
 		}
 
-		setCookies(w, CreateObjectRefreshToken, accessToken, h.config.RefreshTokenTTL, h.config.AccessTokenTTL)
+		if err := h.setCookies(w, CreateObjectRefreshToken, accessToken); err != nil {
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
 
 		response := response{
+			GUID:         userName,
 			Name:         userName,
 			AccessToken:  accessToken,
 			RefreshToken: CreateObjectRefreshToken,
 		}
 
 		if err := jsonRendering(w, response); err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
 			return
 		}
 	}
@@ -113,49 +184,212 @@ func (h *Handler) refreshHandler() http.HandlerFunc {
 func (h *Handler) authHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "This method is not allowed", http.StatusMethodNotAllowed)
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
 			return
 		}
 
-		userName, err := getHeader(r, name)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Header '%v' is missing", name), http.StatusBadRequest)
+		userName, ok := h.requireUserGUID(w, r)
+		if !ok {
 			return
 		}
 
-		if err := h.auth.CheckCountTokens(userName); err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		ip := getClientIP(r, h.config.TrustedNets)
+
+		if err := h.auth.CheckCountTokens(r.Context(), userName); err != nil {
+			writeServiceError(w, r, err)
 			return
 		}
 
+		pairID := h.auth.CreateObjectPairID()
+
 		refreshToken, err := h.auth.RefreshToken(userName)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
 			return
 		}
 
-		if err := h.auth.InsertToken(refreshToken, userName); err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := h.auth.InsertToken(r.Context(), refreshToken, userName, pairID, ip, getDevice(r)); err != nil {
+			writeServiceError(w, r, err)
 			return
 		}
 
-		accessToken, err := h.auth.MakeAccessToken(userName)
+		accessToken, err := h.auth.MakeAccessToken(r.Context(), userName, pairID, ip)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
 			return
 		}
 
-		setCookies(w, refreshToken, accessToken, h.config.RefreshTokenTTL, h.config.AccessTokenTTL)
+		if err := h.setCookies(w, refreshToken, accessToken); err != nil {
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
 
 		response := response{
+			GUID:         userName,
 			Name:         userName,
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken,
 		}
 
 		if err := jsonRendering(w, response); err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
+	}
+}
+
+func (h *Handler) requireUserGUID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userGUID, err := getUserGUID(r, h.config.LegacyNameHeader)
+	if errors.Is(err, errInvalidGUID) {
+		httperr.Write(w, r, http.StatusBadRequest, codeInvalidGUID, err.Error())
+		return "", false
+	}
+	if err != nil {
+		httperr.Write(w, r, http.StatusBadRequest, codeMissingGUID, err.Error())
+		return "", false
+	}
+
+	if r.URL.Query().Get(guidParam) == "" {
+		deprecateNameHeader(w, r)
+	}
+
+	logger.SetSubject(r.Context(), userGUID)
+
+	return userGUID, true
+}
+
+func (h *Handler) introspectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
+			return
+		}
+
+		// RFC 7662: the token comes in a form-encoded body, never in the URL where logs and proxies keep it.
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		if err := r.ParseForm(); err != nil {
+			httperr.Write(w, r, http.StatusBadRequest, codeInvalidBody, "Request body is not a valid form")
+			return
+		}
+
+		accessToken := r.PostForm.Get(tokenParam)
+		if accessToken == "" {
+			httperr.Write(w, r, http.StatusBadRequest, codeMissingToken, fmt.Sprintf("Form parameter '%v' is missing", tokenParam))
+			return
+		}
+
+		response := introspectResponse{}
+
+		if claims, err := h.auth.ParseAccessToken(r.Context(), accessToken); err == nil {
+			response = introspectResponse{
+				Active:    true,
+				Subject:   claims.Subject,
+				GUID:      claims.GUID,
+				IP:        claims.IP,
+				ExpiresAt: claims.ExpiresAt,
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := jsonRendering(w, response); err != nil {
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
+	}
+}
+
+func (h *Handler) jwksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+
+		if err := jsonRendering(w, h.auth.JWKS()); err != nil {
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
+	}
+}
+
+// reloadKeysHandler is disabled unless ADMIN_TOKEN is set.
+func (h *Handler) reloadKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.config.Admin.Token == "" {
+			httperr.Write(w, r, http.StatusNotFound, codeNotFound, "Not Found")
 			return
 		}
+
+		if r.Method != http.MethodPost {
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
+			return
+		}
+
+		adminToken, err := getBearerToken(r)
+		if err != nil || subtle.ConstantTimeCompare([]byte(adminToken), []byte(h.config.Admin.Token)) != 1 {
+			httperr.Write(w, r, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := h.auth.ReloadKeys(r.Context()); err != nil {
+			httperr.Write(w, r, http.StatusInternalServerError, codeInternal, "Internal Server Error")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) logoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
+			return
+		}
+
+		claims, ok := authn.ClaimsFromContext(r.Context())
+		if !ok {
+			httperr.Write(w, r, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+			return
+		}
+
+		refreshTokenFromRequest, ok := h.requireRefreshToken(w, r)
+		if !ok {
+			return
+		}
+
+		if err := h.auth.Logout(r.Context(), refreshTokenFromRequest, claims); err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		h.clearCookies(w)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) logoutAllHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.Write(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "This method is not allowed")
+			return
+		}
+
+		claims, ok := authn.ClaimsFromContext(r.Context())
+		if !ok {
+			httperr.Write(w, r, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := h.auth.LogoutAll(r.Context(), claims); err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+
+		h.clearCookies(w)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,453 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+	"github.com/DarRo9/Test-task-BackDev/internal/metrics"
+	"github.com/DarRo9/Test-task-BackDev/internal/service"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testGUID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+type fakeAuth struct {
+	takeValidTokenErr error
+	refreshToken      string
+	requestID         string
+	reloads           int
+	accessClaims      *auth.IndividualRequirements
+	parsedToken       string
+}
+
+func (a *fakeAuth) CreateObjectPairID() string {
+	return "pair"
+}
+
+func (a *fakeAuth) RefreshToken(userName string) (string, error) {
+	return "refresh", nil
+}
+
+func (a *fakeAuth) MakeAccessToken(ctx context.Context, userName string, pairID string, ip string) (string, error) {
+	return "access", nil
+}
+
+func (a *fakeAuth) TakeValidToken(ctx context.Context, refreshToken string, accessToken string, userName string, ip string) error {
+	a.refreshToken = refreshToken
+	a.requestID = requestid.FromContext(ctx)
+
+	return a.takeValidTokenErr
+}
+
+func (a *fakeAuth) CheckCountTokens(ctx context.Context, userName string) error {
+	return nil
+}
+
+func (a *fakeAuth) InsertToken(ctx context.Context, refreshToken string, userName string, pairID string, ip string, device string) error {
+	return nil
+}
+
+func (a *fakeAuth) SelectToken(ctx context.Context, oldToken string, newToken string, userName string, pairID string, ip string) error {
+	return nil
+}
+
+func (a *fakeAuth) ParseAccessToken(ctx context.Context, accessToken string) (*auth.IndividualRequirements, error) {
+	a.parsedToken = accessToken
+
+	if a.accessClaims == nil || accessToken != "access" {
+		return nil, service.ErrAccessTokenInvalid
+	}
+
+	return a.accessClaims, nil
+}
+
+func (a *fakeAuth) Logout(ctx context.Context, refreshToken string, claims *auth.IndividualRequirements) error {
+	return nil
+}
+
+func (a *fakeAuth) LogoutAll(ctx context.Context, claims *auth.IndividualRequirements) error {
+	return nil
+}
+
+func (a *fakeAuth) ReloadKeys(ctx context.Context) error {
+	a.reloads++
+
+	return nil
+}
+
+func (a *fakeAuth) JWKS() auth.JWKS {
+	return auth.JWKS{Keys: []auth.JWK{{Kty: "OKP", Use: "sig", Alg: auth.AlgEdDSA, Kid: "key-1", Crv: "Ed25519", X: "x"}}}
+}
+
+func createObjectTestConfig() *config.Config {
+	return &config.Config{
+		Refresh: config.Refresh{
+			Sources: []string{config.RefreshSourceCookie, config.RefreshSourceBody, config.RefreshSourceHeader},
+			Cookie: config.Cookie{
+				Name:       "refresh_token",
+				Path:       "/",
+				Secure:     true,
+				SameSite:   "strict",
+				CSRFName:   "csrf_token",
+				CSRFHeader: "X-CSRF-Token",
+			},
+		},
+	}
+}
+
+func createObjectTestHandler(a Auth) http.Handler {
+	return createObjectTestHandlerWithConfig(createObjectTestConfig(), a)
+}
+
+func createObjectTestHandlerWithConfig(cfg *config.Config, a Auth) http.Handler {
+	passThrough := func(next http.Handler) http.Handler {
+		return next
+	}
+
+	return CreateObject(cfg, a, passThrough, passThrough, &fakeMetrics{}).CreateObjectRouter()
+}
+
+type fakeMetrics struct {
+	requests []string
+}
+
+func (m *fakeMetrics) ObserveRequest(handler string, status int, duration time.Duration) {
+	m.requests = append(m.requests, fmt.Sprintf("%s %d", handler, status))
+}
+
+func TestHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		auth    *fakeAuth
+		status  int
+		code    string
+	}{
+		{"method not allowed", http.MethodPost, "/auth", nil, &fakeAuth{}, http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"unknown path", http.MethodGet, "/unknown", nil, &fakeAuth{}, http.StatusNotFound, codeNotFound},
+		{"unknown subpath", http.MethodPost, "/auth/unknown", nil, &fakeAuth{}, http.StatusNotFound, codeNotFound},
+		{"missing guid", http.MethodGet, "/auth", map[string]string{"Name": "user"}, &fakeAuth{}, http.StatusBadRequest, codeMissingGUID},
+		{"invalid guid", http.MethodGet, "/auth?guid=user", nil, &fakeAuth{}, http.StatusBadRequest, codeInvalidGUID},
+		{"missing token", http.MethodPost, "/refresh?guid=" + testGUID, nil, &fakeAuth{}, http.StatusBadRequest, codeMissingRefreshToken},
+		{"logout without claims", http.MethodPost, "/logout", map[string]string{"Token": "refresh"}, &fakeAuth{}, http.StatusUnauthorized, codeUnauthorized},
+		{
+			"reused refresh token",
+			http.MethodPost,
+			"/refresh?guid=" + testGUID,
+			map[string]string{"Token": "refresh", "Authorization": "Bearer access"},
+			&fakeAuth{takeValidTokenErr: service.ErrTokenReused},
+			http.StatusUnauthorized,
+			"token_reused",
+		},
+		{
+			"storage unavailable",
+			http.MethodPost,
+			"/refresh?guid=" + testGUID,
+			map[string]string{"Token": "refresh", "Authorization": "Bearer access"},
+			&fakeAuth{takeValidTokenErr: service.ErrStorageUnavailable},
+			http.StatusServiceUnavailable,
+			"storage_unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Request-ID", "request-1")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			createObjectTestHandler(tt.auth).ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response httperr.Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Equal(t, tt.code, response.Error.Code)
+			require.NotEmpty(t, response.Error.Message)
+			require.Equal(t, "request-1", response.RequestID)
+			require.Equal(t, "request-1", w.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	a := &fakeAuth{}
+
+	req := httptest.NewRequest(http.MethodPost, "/refresh?guid="+testGUID, nil)
+	req.Header.Set("Token", "refresh")
+	req.Header.Set("Authorization", "Bearer access")
+	w := httptest.NewRecorder()
+
+	createObjectTestHandler(a).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEmpty(t, a.requestID)
+	require.Equal(t, a.requestID, w.Header().Get("X-Request-ID"))
+}
+
+func TestAuthHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		headers          map[string]string
+		legacyNameHeader bool
+		guid             string
+	}{
+		{"guid", "/auth?guid=" + testGUID, nil, false, testGUID},
+		{"uppercase guid", "/auth?guid=0F8FAD5B-D9CB-469F-A165-70867728950E", nil, false, testGUID},
+		{"legacy name header", "/auth", map[string]string{"Name": "user"}, true, "user"},
+		{"guid takes precedence", "/auth?guid=" + testGUID, map[string]string{"Name": "user"}, true, testGUID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createObjectTestConfig()
+			cfg.LegacyNameHeader = tt.legacyNameHeader
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			createObjectTestHandlerWithConfig(cfg, &fakeAuth{}).ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var body response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			require.Equal(t, tt.guid, body.GUID)
+
+			if tt.guid == "user" {
+				require.Equal(t, "true", w.Header().Get("Deprecation"))
+				require.Contains(t, w.Header().Get("Warning"), "299 - ")
+			} else {
+				require.Empty(t, w.Header().Get("Deprecation"))
+				require.Empty(t, w.Header().Get("Warning"))
+			}
+		})
+	}
+}
+
+func TestIntrospectHandler(t *testing.T) {
+	claims := &auth.IndividualRequirements{
+		Claims: auth.Claims{Subject: testGUID, ExpiresAt: 1700000000},
+		GUID:   "pair",
+		IP:     "127.0.0.1",
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    introspectResponse
+	}{
+		{
+			name:        "active",
+			method:      http.MethodPost,
+			target:      "/introspect",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "token=access",
+			wantStatus:  http.StatusOK,
+			wantBody:    introspectResponse{Active: true, Subject: testGUID, GUID: "pair", IP: "127.0.0.1", ExpiresAt: 1700000000},
+		},
+		{
+			name:        "inactive",
+			method:      http.MethodPost,
+			target:      "/introspect",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "token=garbage",
+			wantStatus:  http.StatusOK,
+			wantBody:    introspectResponse{},
+		},
+		{
+			name:       "query parameter is ignored",
+			method:     http.MethodPost,
+			target:     "/introspect?token=access",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "JSON body is not a form",
+			method:      http.MethodPost,
+			target:      "/introspect",
+			contentType: "application/json",
+			body:        `{"token":"access"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:       "GET is not allowed",
+			method:     http.MethodGet,
+			target:     "/introspect?token=access",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &fakeAuth{accessClaims: claims}
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			createObjectTestHandler(a).ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantStatus != http.StatusOK {
+				require.Empty(t, a.parsedToken)
+				return
+			}
+
+			var body introspectResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+			require.Equal(t, tt.wantBody, body)
+			require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	createObjectTestHandler(&fakeAuth{}).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var jwks auth.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, "key-1", jwks.Keys[0].Kid)
+}
+
+func TestReloadKeysHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		status     int
+		reloads    int
+	}{
+		{"disabled", "", "Bearer secret", http.StatusNotFound, 0},
+		{"missing token", "secret", "", http.StatusUnauthorized, 0},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized, 0},
+		{"reload", "secret", "Bearer secret", http.StatusNoContent, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createObjectTestConfig()
+			cfg.Admin.Token = tt.adminToken
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/keys/reload", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			a := &fakeAuth{}
+			createObjectTestHandlerWithConfig(cfg, a).ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.reloads, a.reloads)
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	prometheus := metrics.CreateObjectPrometheus()
+	passThrough := func(next http.Handler) http.Handler {
+		return next
+	}
+	router := CreateObject(createObjectTestConfig(), &fakeAuth{}, passThrough, passThrough, prometheus).CreateObjectRouter()
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth?guid="+testGUID, nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	prometheus.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `auth_http_request_duration_seconds_count{code="200",handler="auth"} 1`)
+	require.Contains(t, w.Body.String(), `auth_http_request_duration_seconds_count{code="400",handler="auth"} 1`)
+	require.Contains(t, w.Body.String(), `auth_http_request_duration_seconds_count{code="200",handler="jwks"} 1`)
+}
+
+func TestInstrumentKeepsFlusherAndHijacker(t *testing.T) {
+	h := CreateObject(createObjectTestConfig(), &fakeAuth{}, nil, nil, &fakeMetrics{})
+
+	var flusher, hijacker bool
+	h.instrument("stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	require.True(t, flusher)
+	require.True(t, hijacker)
+	require.Equal(t, []string{"stream 200"}, h.metrics.(*fakeMetrics).requests)
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth?guid="+testGUID, nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	w := httptest.NewRecorder()
+
+	createObjectTestHandler(&fakeAuth{}).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "auth", spans[0].Name())
+	require.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	require.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	require.Equal(t, spanID, spans[0].Parent().SpanID().String())
+	require.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+}
@@ -0,0 +1,38 @@
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+)
+
+type Body struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Response struct {
+	Error     Body   `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write renders the error envelope shared by every endpoint and middleware.
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	js, err := json.Marshal(Response{
+		Error: Body{
+			Code:    code,
+			Message: message,
+		},
+		RequestID: requestid.FromContext(r.Context()),
+	})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(js)
+}
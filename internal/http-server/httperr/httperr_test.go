@@ -0,0 +1,38 @@
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest("GET", "/auth", nil)
+	req = req.WithContext(requestid.WithID(req.Context(), "request-1"))
+	w := httptest.NewRecorder()
+
+	Write(w, req, http.StatusBadRequest, "missing_header", "Header 'Name' is missing")
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	var response Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "missing_header", response.Error.Code)
+	require.Equal(t, "Header 'Name' is missing", response.Error.Message)
+	require.Equal(t, "request-1", response.RequestID)
+}
+
+func TestWriteWithoutRequestID(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	Write(w, httptest.NewRequest("GET", "/auth", nil), http.StatusNotFound, "not_found", "Not Found")
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.NotContains(t, w.Body.String(), "request_id")
+}
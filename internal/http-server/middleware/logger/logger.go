@@ -1,49 +1,144 @@
 package logger
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"time"
+
+	"golang.org/x/exp/slog"
 )
 
-type Logger struct {
-	w      http.ResponseWriter
-	status int
+type contextKey struct{}
+
+// entry collects what inner handlers learn about the request, such as the user it acts for.
+type entry struct {
+	subject    string
+	deprecated string
 }
 
-func (rl *Logger) LogRequestInfo(method, path, remoteAddr, userAgent string, duration time.Duration) {
-	fmt.Printf("request completed - method: %s, path: %s, remote_addr: %s, user_agent: %s, duration: %s, status_code: %d\n",
-		method, path, remoteAddr, userAgent, duration.String(), rl.status)
+// CreateObjectMiddleware logs every completed request through log with its status,
+// response size, latency and the subject recorded by SetSubject. The request ID is added
+// by the log handler from the request context. Requests that used a feature recorded by
+// SetDeprecated are logged as warnings.
+func CreateObjectMiddleware(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := CreateObjectResponseWriter(w)
+			e := &entry{}
+			start := time.Now()
+
+			defer func() {
+				level := slog.LevelInfo
+				attrs := []slog.Attr{
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.String("user_agent", r.UserAgent()),
+					slog.String("subject", e.subject),
+					slog.Int("status", rw.status),
+					slog.Int64("bytes", rw.bytes),
+					slog.Duration("latency", time.Since(start)),
+				}
+
+				if e.deprecated != "" {
+					level = slog.LevelWarn
+					attrs = append(attrs, slog.String("deprecated", e.deprecated))
+				}
+
+				log.LogAttrs(r.Context(), level, "Request completed", attrs...)
+			}()
+
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey{}, e)))
+		})
+	}
 }
 
-func (rl *Logger) Header() http.Header {
-	return rl.w.Header()
+// SetSubject records the user the request acts for. It does nothing outside the middleware.
+func SetSubject(ctx context.Context, subject string) {
+	if e, ok := ctx.Value(contextKey{}).(*entry); ok {
+		e.subject = subject
+	}
 }
 
-func CreateObjectLogger(w http.ResponseWriter) *Logger {
-	return &Logger{
-		w:      w,
-		status: http.StatusOK,
+// SetDeprecated records that the request relied on a deprecated feature, so its clients can be found
+// in the logs before the feature is removed. It does nothing outside the middleware.
+func SetDeprecated(ctx context.Context, feature string) {
+	if e, ok := ctx.Value(contextKey{}).(*entry); ok {
+		e.deprecated = feature
 	}
 }
 
-func (rl *Logger) Write(b []byte) (int, error) {
-	return rl.w.Write(b)
+// ResponseWriter remembers the status and the number of body bytes written.
+// It passes Flush and Hijack through, so wrapping a writer does not hide them.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
 }
 
-func (rl *Logger) WriteHeader(statusCode int) {
-	rl.status = statusCode
+func CreateObjectResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+// Status is the status sent to the client, http.StatusOK until the handler writes one.
+func (rw *ResponseWriter) Status() int {
+	return rw.status
 }
 
-func Log(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rl := CreateObjectLogger(w)
-		t1 := time.Now()
+func (rw *ResponseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
 
-		defer func() {
-			rl.LogRequestInfo(r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent(), time.Since(t1))
-		}()
+	rw.status = statusCode
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+
+	return n, err
+}
+
+func (rw *ResponseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+
+	return conn, buf, err
+}
 
-		next.ServeHTTP(rl, r)
-	})
+// Unwrap lets http.ResponseController reach the original writer.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/requestid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func serve(t *testing.T, next http.HandlerFunc, w http.ResponseWriter) map[string]interface{} {
+	var buf bytes.Buffer
+	log := slog.New(requestid.CreateObjectLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.Header.Set("X-Request-ID", "request-1")
+
+	requestid.Assign(CreateObjectMiddleware(log)(next)).ServeHTTP(w, r)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+
+	return record
+}
+
+func TestMiddlewareStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		SetSubject(r.Context(), "user")
+		w.WriteHeader(http.StatusNoContent)
+		w.WriteHeader(http.StatusInternalServerError)
+	}, w)
+
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "Request completed", record["msg"])
+	require.Equal(t, float64(http.StatusNoContent), record["status"])
+	require.Equal(t, float64(0), record["bytes"])
+	require.Equal(t, "user", record["subject"])
+	require.Equal(t, "request-1", record["request_id"])
+	require.Equal(t, http.MethodPost, record["method"])
+	require.Equal(t, "/logout", record["path"])
+	require.Contains(t, record, "latency")
+}
+
+func TestMiddlewareDeprecated(t *testing.T) {
+	record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		SetDeprecated(r.Context(), "Name header")
+	}, httptest.NewRecorder())
+
+	require.Equal(t, "WARN", record["level"])
+	require.Equal(t, "Name header", record["deprecated"])
+
+	record = serve(t, func(w http.ResponseWriter, r *http.Request) {}, httptest.NewRecorder())
+
+	require.Equal(t, "INFO", record["level"])
+	require.NotContains(t, record, "deprecated")
+}
+
+func TestMiddlewareError(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}, w)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, float64(http.StatusNotFound), record["status"])
+	require.Equal(t, float64(w.Body.Len()), record["bytes"])
+	require.Equal(t, "", record["subject"])
+}
+
+func TestMiddlewareImplicitStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+	}, w)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, w.Flushed)
+	require.Equal(t, float64(http.StatusOK), record["status"])
+	require.Equal(t, float64(5), record["bytes"])
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (h hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, nil, nil
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	record := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		require.Equal(t, server, conn)
+	}, hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: server})
+
+	require.Equal(t, float64(http.StatusSwitchingProtocols), record["status"])
+
+	serve(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		require.Error(t, err)
+	}, httptest.NewRecorder())
+}
@@ -0,0 +1,74 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestAssign(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		accepted bool
+	}{
+		{"client id", "request-1", true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", maxLength+1), false},
+		{"control characters", "request\n1", false},
+		{"spaces", "request 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set(Header, tt.header)
+			w := httptest.NewRecorder()
+
+			Assign(next).ServeHTTP(w, req)
+
+			require.Equal(t, fromContext, w.Header().Get(Header))
+
+			if tt.accepted {
+				require.Equal(t, tt.header, fromContext)
+			} else {
+				_, err := uuid.Parse(fromContext)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(CreateObjectLogHandler(slog.NewJSONHandler(&buf, nil))).With(slog.String("component", "test"))
+
+	log.InfoContext(WithID(context.Background(), "request-1"), "with id")
+	log.InfoContext(context.Background(), "without id")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[0], &record))
+	require.Equal(t, "request-1", record["request_id"])
+	require.Equal(t, "test", record["component"])
+
+	record = nil
+	require.NoError(t, json.Unmarshal(lines[1], &record))
+	require.NotContains(t, record, "request_id")
+}
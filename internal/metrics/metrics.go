@@ -0,0 +1,154 @@
+// Package metrics exposes token lifecycle, HTTP and storage metrics in Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+type Prometheus struct {
+	registry        *prometheus.Registry
+	tokensIssued    prometheus.Counter
+	tokenRefreshes  prometheus.Counter
+	tokenFailures   *prometheus.CounterVec
+	tokenReuses     prometheus.Counter
+	ipChanges       prometheus.Counter
+	requestDuration *prometheus.HistogramVec
+	hashDuration    prometheus.Histogram
+	storageDuration *prometheus.HistogramVec
+}
+
+func CreateObjectPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		tokensIssued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Access tokens issued.",
+		}),
+		tokenRefreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "Refresh tokens rotated.",
+		}),
+		tokenFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_failures_total",
+			Help:      "Rejected token operations by reason.",
+		}, []string{"reason"}),
+		tokenReuses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_reuse_detections_total",
+			Help:      "Rotated refresh tokens presented again.",
+		}),
+		ipChanges: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ip_change_warnings_total",
+			Help:      "Refreshes from an IP address other than the one the token was issued to.",
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler", "code"}),
+		hashDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bcrypt_duration_seconds",
+			Help:      "Time spent hashing refresh tokens with bcrypt.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 8),
+		}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of storage operations by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.tokensIssued,
+		p.tokenRefreshes,
+		p.tokenFailures,
+		p.tokenReuses,
+		p.ipChanges,
+		p.requestDuration,
+		p.hashDuration,
+		p.storageDuration,
+	)
+
+	return p
+}
+
+// Handler serves the collected metrics in the Prometheus text format.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) TokenIssued() {
+	p.tokensIssued.Inc()
+}
+
+func (p *Prometheus) TokenRefreshed() {
+	p.tokenRefreshes.Inc()
+}
+
+func (p *Prometheus) TokenFailed(reason string) {
+	p.tokenFailures.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) TokenReused() {
+	p.tokenReuses.Inc()
+}
+
+func (p *Prometheus) IPChanged() {
+	p.ipChanges.Inc()
+}
+
+func (p *Prometheus) ObserveRequest(handler string, status int, duration time.Duration) {
+	p.requestDuration.WithLabelValues(handler, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveHash(duration time.Duration) {
+	p.hashDuration.Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveStorage(method string, duration time.Duration) {
+	p.storageDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// Noop discards every measurement and serves no metrics.
+type Noop struct{}
+
+func CreateObjectNoop() Noop {
+	return Noop{}
+}
+
+func (Noop) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+func (Noop) TokenIssued() {}
+
+func (Noop) TokenRefreshed() {}
+
+func (Noop) TokenFailed(reason string) {}
+
+func (Noop) TokenReused() {}
+
+func (Noop) IPChanged() {}
+
+func (Noop) ObserveRequest(handler string, status int, duration time.Duration) {}
+
+func (Noop) ObserveHash(duration time.Duration) {}
+
+func (Noop) ObserveStorage(method string, duration time.Duration) {}
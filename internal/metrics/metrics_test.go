@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheus(t *testing.T) {
+	p := CreateObjectPrometheus()
+
+	p.TokenIssued()
+	p.TokenRefreshed()
+	p.TokenFailed("token_reused")
+	p.TokenReused()
+	p.IPChanged()
+	p.ObserveRequest("refresh", http.StatusUnauthorized, 20*time.Millisecond)
+	p.ObserveHash(50 * time.Millisecond)
+	p.ObserveStorage("GetTokenByID", 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	require.Contains(t, body, "auth_tokens_issued_total 1")
+	require.Contains(t, body, "auth_token_refreshes_total 1")
+	require.Contains(t, body, `auth_token_failures_total{reason="token_reused"} 1`)
+	require.Contains(t, body, "auth_token_reuse_detections_total 1")
+	require.Contains(t, body, "auth_ip_change_warnings_total 1")
+	require.Contains(t, body, `auth_http_request_duration_seconds_count{code="401",handler="refresh"} 1`)
+	require.Contains(t, body, "auth_bcrypt_duration_seconds_count 1")
+	require.Contains(t, body, `auth_storage_operation_duration_seconds_count{method="GetTokenByID"} 1`)
+	require.Contains(t, body, "go_goroutines")
+}
@@ -6,9 +6,39 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is a refresh token record. Records sharing FamilyID belong to one session.
 type User struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name         string             `bson:"name"`
-	RefreshToken string             `bson:"refresh_token"`
-	CreatedTime  time.Time          `bson:"created_time"`
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name               string             `bson:"name"`
+	TokenID            string             `bson:"token_id"`
+	RefreshToken       string             `bson:"refresh_token"`
+	PairID             string             `bson:"pair_id"`
+	FamilyID           string             `bson:"family_id"`
+	Device             string             `bson:"device"`
+	IP                 string             `bson:"ip"`
+	CreatedTime        time.Time          `bson:"created_time"`
+	SessionCreatedTime time.Time          `bson:"session_created_time"`
+	Used               bool               `bson:"used"`
+	UsedTime           time.Time          `bson:"used_time,omitempty"`
+	ExpiresTime        time.Time          `bson:"expires_time,omitempty"`
+}
+
+// Expired reports whether the record has outlived its refresh token. Records written
+// before ExpiresTime existed have it zero and never expire here.
+func (u User) Expired(now time.Time) bool {
+	return !u.ExpiresTime.IsZero() && !u.ExpiresTime.After(now)
+}
+
+type DeniedToken struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	GUID        string             `bson:"guid"`
+	ExpiresTime time.Time          `bson:"expires_time"`
+}
+
+type Profile struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name   string             `bson:"name"`
+	Email  string             `bson:"email"`
+	Roles  []string           `bson:"roles,omitempty"`
+	Tenant string             `bson:"tenant,omitempty"`
 }
@@ -0,0 +1,161 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/lib/logger/sl"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrQueueFull = errors.New("notification queue is full")
+	ErrClosed    = errors.New("notifier is closed")
+)
+
+type Async struct {
+	next       Notifier
+	log        *slog.Logger
+	queue      chan Message
+	ctx        context.Context
+	cancel     context.CancelFunc
+	retries    int
+	retryDelay time.Duration
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+	closed     bool
+}
+
+// CreateObjectAsync delivers messages through next in the background. A failed message is
+// tried again up to retries times, waiting retryDelay and then twice as long each time.
+// Zero or negative retries mean a single attempt.
+func CreateObjectAsync(next Notifier, log *slog.Logger, queueSize int, retries int, retryDelay time.Duration) *Async {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := &Async{
+		next:       next,
+		log:        log,
+		queue:      make(chan Message, queueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		retries:    retries,
+		retryDelay: retryDelay,
+	}
+
+	a.wg.Add(1)
+	go a.run()
+
+	return a
+}
+
+func (a *Async) Send(ctx context.Context, msg Message) error {
+	const op = "notifier.Async.Send"
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return fmt.Errorf("%s: %w", op, ErrClosed)
+	}
+
+	select {
+	case a.queue <- msg:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
+}
+
+// Close stops accepting messages and waits until the queue is drained.
+// Once ctx is done the delivery in progress is cancelled, the messages left are dropped
+// and Close returns ctx.Err() without waiting further.
+// The wrapped notifier is closed after the last delivery.
+func (a *Async) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		a.cancel()
+
+		return a.closeNext()
+	case <-ctx.Done():
+		a.cancel()
+
+		go func() {
+			<-drained
+			if err := a.closeNext(); err != nil {
+				a.log.Error("Fail of closing notifier", sl.Err(err))
+			}
+		}()
+
+		return ctx.Err()
+	}
+}
+
+func (a *Async) closeNext() error {
+	if c, ok := a.next.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func (a *Async) run() {
+	defer a.wg.Done()
+
+	for msg := range a.queue {
+		a.deliver(msg)
+	}
+}
+
+func (a *Async) deliver(msg Message) {
+	delay := a.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		if a.ctx.Err() != nil {
+			a.log.Error("Fail of sending notification", slog.String("to", msg.To), sl.Err(a.ctx.Err()))
+			return
+		}
+
+		err := a.next.Send(a.ctx, msg)
+		if err == nil {
+			return
+		}
+
+		if attempt >= a.retries || a.ctx.Err() != nil {
+			a.log.Error("Fail of sending notification", slog.String("to", msg.To), sl.Err(err))
+			return
+		}
+
+		a.log.Warn("Retry of sending notification", slog.String("to", msg.To), slog.Int("attempt", attempt+1), sl.Err(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-a.ctx.Done():
+			timer.Stop()
+			a.log.Error("Fail of sending notification", slog.String("to", msg.To), sl.Err(err))
+			return
+		}
+
+		delay *= 2
+	}
+}
@@ -0,0 +1,166 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type flakyNotifier struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []Message
+}
+
+func (f *flakyNotifier) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("temporary failure")
+	}
+
+	f.sent = append(f.sent, msg)
+
+	return nil
+}
+
+func TestAsyncRetries(t *testing.T) {
+	next := &flakyNotifier{failures: 2}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(next, log, 10, 3, time.Millisecond)
+
+	err := a.Send(context.Background(), Message{To: "user@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, a.Close(context.Background()))
+
+	require.Equal(t, 3, next.calls)
+	require.Len(t, next.sent, 1)
+}
+
+func TestAsyncRetriesExhausted(t *testing.T) {
+	next := &flakyNotifier{failures: 10}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(next, log, 10, 2, time.Millisecond)
+
+	err := a.Send(context.Background(), Message{To: "user@example.com"})
+	require.NoError(t, err)
+
+	require.NoError(t, a.Close(context.Background()))
+
+	require.Equal(t, 3, next.calls)
+	require.Empty(t, next.sent)
+}
+
+func TestAsyncNegativeRetries(t *testing.T) {
+	next := &flakyNotifier{failures: 10}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(next, log, 10, -1, time.Millisecond)
+
+	require.NoError(t, a.Send(context.Background(), Message{To: "user@example.com"}))
+	require.NoError(t, a.Close(context.Background()))
+
+	require.Equal(t, 1, next.calls)
+}
+
+func TestAsyncCloseInterruptsBackoff(t *testing.T) {
+	next := &flakyNotifier{failures: 10}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(next, log, 10, 5, time.Hour)
+
+	require.NoError(t, a.Send(context.Background(), Message{To: "first@example.com"}))
+	require.NoError(t, a.Send(context.Background(), Message{To: "second@example.com"}))
+
+	require.Eventually(t, func() bool {
+		next.mu.Lock()
+		defer next.mu.Unlock()
+
+		return next.calls > 0
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	require.ErrorIs(t, a.Close(ctx), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	a.wg.Wait()
+	require.Equal(t, 1, next.calls)
+}
+
+// hungNotifier blocks like an SMTP server that never answers, until ctx is done.
+type hungNotifier struct {
+	called chan struct{}
+	err    chan error
+}
+
+func (h *hungNotifier) Send(ctx context.Context, msg Message) error {
+	close(h.called)
+	<-ctx.Done()
+	h.err <- ctx.Err()
+
+	return ctx.Err()
+}
+
+func TestAsyncCloseCancelsDelivery(t *testing.T) {
+	next := &hungNotifier{called: make(chan struct{}), err: make(chan error, 1)}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(next, log, 10, 5, time.Millisecond)
+
+	require.NoError(t, a.Send(context.Background(), Message{To: "user@example.com"}))
+	<-next.called
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	require.ErrorIs(t, a.Close(ctx), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	select {
+	case err := <-next.err:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("delivery was not cancelled")
+	}
+}
+
+func TestAsyncSendAfterClose(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	a := CreateObjectAsync(CreateObjectNoop(), log, 1, 0, time.Millisecond)
+	require.NoError(t, a.Close(context.Background()))
+	require.NoError(t, a.Close(context.Background()))
+
+	err := a.Send(context.Background(), Message{To: "user@example.com"})
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestAsyncClosesNext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := CreateObjectOutbox(path)
+	require.NoError(t, err)
+
+	a := CreateObjectAsync(outbox, slog.New(slog.NewTextHandler(io.Discard, nil)), 1, 0, time.Millisecond)
+	require.NoError(t, a.Close(context.Background()))
+
+	require.ErrorIs(t, outbox.Send(context.Background(), Message{To: "user@example.com"}), os.ErrClosed)
+}
@@ -0,0 +1,15 @@
+package notifier
+
+import (
+	"context"
+)
+
+type Noop struct{}
+
+func CreateObjectNoop() *Noop {
+	return &Noop{}
+}
+
+func (n *Noop) Send(ctx context.Context, msg Message) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type Outbox struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type outboxRecord struct {
+	Message
+	SentTime time.Time `json:"sent_time"`
+}
+
+func CreateObjectOutbox(path string) (*Outbox, error) {
+	const op = "notifier.CreateObjectOutbox"
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Outbox{w: file}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	const op = "notifier.Outbox.Send"
+
+	js, err := json.Marshal(outboxRecord{Message: msg, SentTime: time.Now()})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, err := o.w.Write(append(js, '\n')); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (o *Outbox) Close() error {
+	if c, ok := o.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
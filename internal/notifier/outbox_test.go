@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	outbox, err := CreateObjectOutbox(path)
+	require.NoError(t, err)
+
+	require.NoError(t, outbox.Send(context.Background(), Message{To: "first@example.com", Subject: "IP changed", Body: "body"}))
+	require.NoError(t, outbox.Send(context.Background(), Message{To: "second@example.com"}))
+	require.NoError(t, outbox.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var records []outboxRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record outboxRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, records, 2)
+	require.Equal(t, Message{To: "first@example.com", Subject: "IP changed", Body: "body"}, records[0].Message)
+	require.False(t, records[0].SentTime.IsZero())
+	require.Equal(t, "second@example.com", records[1].To)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestOutboxAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o600))
+
+	outbox, err := CreateObjectOutbox(path)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Send(context.Background(), Message{To: "user@example.com"}))
+	require.NoError(t, outbox.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "{}\n{\"to\":\"user@example.com\"")
+}
+
+func TestNoop(t *testing.T) {
+	require.NoError(t, CreateObjectNoop().Send(context.Background(), Message{To: "user@example.com"}))
+}
@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTP struct {
+	host    string
+	addr    string
+	auth    smtp.Auth
+	from    string
+	timeout time.Duration
+}
+
+// CreateObjectSMTP sends mail through host:port. Every message, from dialing to QUIT,
+// must finish within timeout and before the context passed to Send is done.
+func CreateObjectSMTP(host string, port string, user string, password string, from string, timeout time.Duration) *SMTP {
+	var auth smtp.Auth
+	if user != "" && password != "" {
+		auth = smtp.PlainAuth("", user, password, host)
+	}
+
+	return &SMTP{
+		host:    host,
+		addr:    net.JoinHostPort(host, port),
+		auth:    auth,
+		from:    from,
+		timeout: timeout,
+	}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	const op = "notifier.SMTP.Send"
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	if err := s.send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// send does what smtp.SendMail does, over a connection that is closed once ctx is done.
+func (s *SMTP) send(ctx context.Context, msg Message) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return withContextErr(ctx, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return withContextErr(ctx, err)
+		}
+	}
+
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+
+		if err := c.Auth(s.auth); err != nil {
+			return withContextErr(ctx, err)
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return withContextErr(ctx, err)
+	}
+
+	if err := c.Rcpt(msg.To); err != nil {
+		return withContextErr(ctx, err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return withContextErr(ctx, err)
+	}
+
+	if _, err := w.Write(s.build(msg)); err != nil {
+		return withContextErr(ctx, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return withContextErr(ctx, err)
+	}
+
+	return withContextErr(ctx, c.Quit())
+}
+
+// withContextErr reports why the connection was cut instead of the resulting I/O error.
+func withContextErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+
+	return err
+}
+
+func (s *SMTP) build(msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,131 @@
+package notifier
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSMTPServer struct {
+	listener net.Listener
+	data     chan string
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeSMTPServer{listener: listener, data: make(chan string, 1)}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := tp.ReadDotLines()
+			s.data <- strings.Join(data, "\n")
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := startFakeSMTPServer(t)
+
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+
+	s := CreateObjectSMTP(host, port, "", "", "auth@example.com", time.Second)
+
+	err = s.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Warning",
+		Body:    "IP changed",
+	})
+	require.NoError(t, err)
+
+	data := <-server.data
+	require.Contains(t, data, "To: user@example.com")
+	require.Contains(t, data, "Subject: Warning")
+	require.Contains(t, data, "IP changed")
+}
+
+func TestSMTPSendError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	listener.Close()
+
+	s := CreateObjectSMTP(host, port, "", "", "auth@example.com", time.Second)
+
+	err = s.Send(context.Background(), Message{To: "user@example.com"})
+	require.Error(t, err)
+}
+
+func TestSMTPSendTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	// The server accepts the connection and never sends a greeting.
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	s := CreateObjectSMTP(host, port, "", "", "auth@example.com", 50*time.Millisecond)
+
+	start := time.Now()
+	err = s.Send(context.Background(), Message{To: "user@example.com"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+
+	s = CreateObjectSMTP(host, port, "", "", "auth@example.com", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start = time.Now()
+	err = s.Send(ctx, Message{To: "user@example.com"})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/DarRo9/Test-task-BackDev/internal/config"
 )
@@ -23,6 +24,22 @@ func CreateObject(config *config.Config, router http.Handler) *Server {
 	return &Server{
 		httpServer: &http.Server{
 			Addr:         config.HTTPServer.Address,
+			Handler:      withDeadline(config.HTTPServer.Timeout, router),
+			ReadTimeout:  config.HTTPServer.Timeout,
+			WriteTimeout: config.HTTPServer.Timeout,
+			IdleTimeout:  config.HTTPServer.IdleTimeout,
+		},
+	}
+}
+
+// CreateObjectMetrics serves only /metrics on the metrics address.
+func CreateObjectMetrics(config *config.Config, metrics http.Handler) *Server {
+	router := http.NewServeMux()
+	router.Handle("/metrics", metrics)
+
+	return &Server{
+		httpServer: &http.Server{
+			Addr:         config.Metrics.Address,
 			Handler:      router,
 			ReadTimeout:  config.HTTPServer.Timeout,
 			WriteTimeout: config.HTTPServer.Timeout,
@@ -30,3 +47,18 @@ func CreateObject(config *config.Config, router http.Handler) *Server {
 		},
 	}
 }
+
+// withDeadline cancels the request context once the response can no longer be written,
+// so storage calls of a timed out request stop as well.
+func withDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	})
+
+	withDeadline(time.Minute, next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth", nil))
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	withDeadline(0, next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth", nil))
+	require.False(t, ok)
+}
+
+func TestCreateObjectMetrics(t *testing.T) {
+	cfg := &config.Config{Metrics: config.Metrics{Address: "localhost:9090"}}
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("auth_tokens_issued_total 0\n"))
+	})
+
+	srv := CreateObjectMetrics(cfg, metrics)
+	require.Equal(t, "localhost:9090", srv.httpServer.Addr)
+
+	w := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "auth_tokens_issued_total")
+
+	w = httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+)
+
+// ClaimsEnricher returns custom claims that MakeAccessToken adds to the access token of a user.
+// Claims named like registered ones, guid or ip are ignored.
+type ClaimsEnricher interface {
+	EnrichClaims(ctx context.Context, userName string) (map[string]interface{}, error)
+}
+
+type ProfileStorage interface {
+	GetProfile(ctx context.Context, userName string) (models.Profile, error)
+}
+
+// ProfileClaims adds roles and tenant from the user profile. Users without a profile get no extra claims.
+type ProfileClaims struct {
+	storage ProfileStorage
+}
+
+func CreateObjectProfileClaims(storage ProfileStorage) *ProfileClaims {
+	return &ProfileClaims{storage: storage}
+}
+
+func (p *ProfileClaims) EnrichClaims(ctx context.Context, userName string) (map[string]interface{}, error) {
+	const op = "service.ProfileClaims.EnrichClaims"
+
+	profile, err := p.storage.GetProfile(ctx, userName)
+	if errors.Is(err, storage.ErrProfileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	claims := make(map[string]interface{})
+
+	if len(profile.Roles) > 0 {
+		claims["roles"] = profile.Roles
+	}
+
+	if profile.Tenant != "" {
+		claims["tenant"] = profile.Tenant
+	}
+
+	return claims, nil
+}
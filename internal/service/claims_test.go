@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type failingEnricher struct{}
+
+func (failingEnricher) EnrichClaims(context.Context, string) (map[string]interface{}, error) {
+	return nil, errors.New("enricher failed")
+}
+
+func TestMakeAccessTokenClaims(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	repo := s.storage.(*memory.RefreshRepo)
+	require.NoError(t, repo.InsertProfile(context.Background(), models.Profile{
+		Name:   "user",
+		Email:  "user@example.com",
+		Roles:  []string{"admin"},
+		Tenant: "acme",
+	}))
+
+	_, accessToken := login(t, s, "user")
+
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+	require.Equal(t, "user", claims.Subject)
+	require.Equal(t, []interface{}{"admin"}, claims.Custom["roles"])
+	require.Equal(t, "acme", claims.Custom["tenant"])
+
+	_, accessToken = login(t, s, "nobody")
+
+	claims, err = s.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+	require.Nil(t, claims.Custom)
+}
+
+func TestMakeAccessTokenEnricherError(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+	s.claimsEnricher = failingEnricher{}
+
+	_, err := s.MakeAccessToken(ctx, "user", s.CreateObjectPairID(), "127.0.0.1")
+	require.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+)
+
+var (
+	ErrTokenNotFound       = errors.New("refresh token not found")
+	ErrTokenInvalid        = errors.New("refresh token invalid")
+	ErrTokenExpired        = errors.New("refresh token expired")
+	ErrTokenReused         = errors.New("refresh token reused")
+	ErrTokenAlreadyRotated = storage.ErrTokenAlreadyRotated
+	ErrPairMismatch        = errors.New("access token was not issued with refresh token")
+	ErrIPMismatch          = errors.New("client IP changed")
+	ErrAccessTokenInvalid  = errors.New("access token invalid")
+	ErrAccessTokenRevoked  = errors.New("access token revoked")
+	ErrTooManySessions     = errors.New("too many sessions")
+	ErrStorageUnavailable  = errors.New("storage unavailable")
+)
+
+var failureReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrTokenNotFound, "token_not_found"},
+	{ErrTokenInvalid, "token_invalid"},
+	{ErrTokenExpired, "token_expired"},
+	{ErrTokenReused, "token_reused"},
+	{ErrTokenAlreadyRotated, "token_already_rotated"},
+	{ErrPairMismatch, "token_pair_mismatch"},
+	{ErrIPMismatch, "ip_mismatch"},
+	{ErrAccessTokenInvalid, "access_token_invalid"},
+	{ErrAccessTokenRevoked, "access_token_revoked"},
+	{ErrTooManySessions, "too_many_sessions"},
+	{ErrStorageUnavailable, "storage_unavailable"},
+}
+
+// failureReason is the metrics label of a rejected token operation.
+func failureReason(err error) string {
+	for _, f := range failureReasons {
+		if errors.Is(err, f.err) {
+			return f.reason
+		}
+	}
+
+	return "internal"
+}
+
+// storageError keeps errors the service knows how to handle and marks the rest as ErrStorageUnavailable.
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrTokenNotFound):
+		return fmt.Errorf("%w: %w", ErrTokenNotFound, err)
+	case errors.Is(err, storage.ErrTokenAlreadyRotated), errors.Is(err, storage.ErrProfileNotFound):
+		return err
+	default:
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+}
@@ -2,53 +2,256 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
 	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/lib/logger/sl"
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/notifier"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
 )
 
 type Service struct {
 	config             *config.Config
 	storage            Storage
 	tokenAuthenticator TokenAuthenticator
+	claimsEnricher     ClaimsEnricher
+	notifier           notifier.Notifier
+	metrics            Metrics
+	log                *slog.Logger
+}
+
+type IPChangedEvent struct {
+	UserName   string
+	PreviousIP string
+	CurrentIP  string
+	Time       time.Time
+}
+
+type TokenReusedEvent struct {
+	UserName string
+	TokenID  string
+	FamilyID string
+	IP       string
+	UsedTime time.Time
+	Time     time.Time
 }
 
 type TokenAuthenticator interface {
-	CreateObjectJWT(userId string, ttl time.Duration) (string, error)
+	CreateObjectJWTWithClaims(userId string, pairID string, ip string, ttl time.Duration, custom map[string]interface{}) (string, error)
+	GetPairID(accessToken string, userId string) (string, error)
+	ParseJWT(accessToken string) (*auth.IndividualRequirements, error)
 	CreateObjectRefreshToken() (string, error)
+	ParseRefreshToken(token string) (auth.RefreshToken, error)
 	HashToken(token string) ([]byte, error)
 	CompareTokens(providedToken string, hashedToken []byte) bool
+	JWKS() auth.JWKS
+	ReloadKeys() (bool, error)
+}
+
+// Metrics counts token lifecycle events.
+type Metrics interface {
+	TokenIssued()
+	TokenRefreshed()
+	TokenFailed(reason string)
+	TokenReused()
+	IPChanged()
+	ObserveHash(duration time.Duration)
 }
 
 type Storage interface {
-	InsertToken(ctx context.Context, userName string, refreshToken string, timeNow time.Time) error
-	DeleteToken(ctx context.Context, refreshToken string) error
+	InsertToken(ctx context.Context, token models.User) error
+	DeleteToken(ctx context.Context, tokenID string) error
 	DeleteTokensByUser(ctx context.Context, userName string) error
-	SelectToken(ctx context.Context, oldRefreshToken string, CreateObjectRefreshToken string, userName string, timeNow time.Time) error
+	SelectToken(ctx context.Context, oldTokenID string, token models.User) error
+	RevokeFamily(ctx context.Context, familyID string) error
 	CountTokens(ctx context.Context, userName string) (int64, error)
-	GetTime(ctx context.Context, refreshToken string, userName string) (time.Time, error)
-	GetTokenByUser(ctx context.Context, userName string) (string, error)
+	GetTokenByID(ctx context.Context, tokenID string) (models.User, error)
+	GetSessionsByUser(ctx context.Context, userName string) ([]models.User, error)
+	GetEmail(ctx context.Context, userName string) (string, error)
+	GetProfile(ctx context.Context, userName string) (models.Profile, error)
+	DenyAccessToken(ctx context.Context, accessTokenGUID string, expiresAt time.Time) error
+	IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error)
 }
 
-func CreateObject(config *config.Config, storage Storage, tokenAuthenticator TokenAuthenticator) (*Service, error) {
+// CreateObject builds the service. claimsEnricher may be nil, then tokens carry no custom claims.
+func CreateObject(config *config.Config, storage Storage, tokenAuthenticator TokenAuthenticator, claimsEnricher ClaimsEnricher, notifier notifier.Notifier, metrics Metrics, log *slog.Logger) (*Service, error) {
 	return &Service{
 		config:             config,
 		storage:            storage,
-		tokenAuthenticator: tokenAuthenticator}, nil
+		tokenAuthenticator: tokenAuthenticator,
+		claimsEnricher:     claimsEnricher,
+		notifier:           notifier,
+		metrics:            metrics,
+		log:                log}, nil
+}
+
+// fail counts a rejected token operation by reason and returns err unchanged.
+func (s *Service) fail(err error) error {
+	s.metrics.TokenFailed(failureReason(err))
+
+	return err
+}
+
+func (s *Service) CreateObjectPairID() string {
+	return uuid.New().String()
 }
 
-func (s *Service) MakeAccessToken(userName string) (string, error) {
+func (s *Service) MakeAccessToken(ctx context.Context, userName string, pairID string, ip string) (_ string, err error) {
 	const op = "service.MakeAccessToken"
 
-	accessToken, err := s.tokenAuthenticator.CreateObjectJWT(userName, s.config.AccessTokenTTL)
+	ctx, done := startSpan(ctx, "service.MakeAccessToken")
+	defer func() { done(err) }()
+
+	var custom map[string]interface{}
+
+	if s.claimsEnricher != nil {
+		custom, err = s.claimsEnricher.EnrichClaims(ctx, userName)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	accessToken, err := s.tokenAuthenticator.CreateObjectJWTWithClaims(userName, pairID, ip, s.config.AccessTokenTTL, custom)
 	if err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	s.metrics.TokenIssued()
+
 	return accessToken, nil
 }
 
+func (s *Service) JWKS() auth.JWKS {
+	return s.tokenAuthenticator.JWKS()
+}
+
+func (s *Service) ReloadKeys(ctx context.Context) (err error) {
+	const op = "service.ReloadKeys"
+
+	ctx, done := startSpan(ctx, "service.ReloadKeys")
+	defer func() { done(err) }()
+
+	rotated, err := s.tokenAuthenticator.ReloadKeys()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.log.InfoContext(ctx, "Signing keys reloaded", slog.Bool("rotated", rotated))
+
+	return nil
+}
+
+func (s *Service) ParseAccessToken(ctx context.Context, accessToken string) (_ *auth.IndividualRequirements, err error) {
+	const op = "service.ParseAccessToken"
+
+	ctx, done := startSpan(ctx, "service.ParseAccessToken")
+	defer func() { done(err) }()
+
+	claims, err := s.tokenAuthenticator.ParseJWT(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrAccessTokenInvalid, err)
+	}
+
+	denied, err := s.IsAccessTokenDenied(ctx, claims.GUID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if denied {
+		return nil, fmt.Errorf("%s: %w", op, ErrAccessTokenRevoked)
+	}
+
+	return claims, nil
+}
+
+func (s *Service) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (_ bool, err error) {
+	const op = "service.IsAccessTokenDenied"
+
+	ctx, done := startSpan(ctx, "service.IsAccessTokenDenied")
+	defer func() { done(err) }()
+
+	denied, err := s.storage.IsAccessTokenDenied(ctx, accessTokenGUID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	return denied, nil
+}
+
+// Logout revokes the session of refreshToken and denylists the access token issued with it.
+// The access token in claims must belong to the same pair as refreshToken.
+func (s *Service) Logout(ctx context.Context, refreshToken string, claims *auth.IndividualRequirements) (err error) {
+	const op = "service.Logout"
+
+	ctx, done := startSpan(ctx, "service.Logout")
+	defer func() { done(err) }()
+
+	parsedToken, tokenFromDB, err := s.getTokenFromDB(ctx, refreshToken, claims.Subject)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ok := s.tokenAuthenticator.CompareTokens(parsedToken.Secret, []byte(tokenFromDB.RefreshToken)); !ok {
+		return fmt.Errorf("%s: %w", op, ErrTokenInvalid)
+	}
+
+	if tokenFromDB.PairID != claims.GUID {
+		return fmt.Errorf("%s: %w", op, ErrPairMismatch)
+	}
+
+	if err := s.storage.RevokeFamily(ctx, tokenFromDB.FamilyID); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	if err := s.storage.DenyAccessToken(ctx, tokenFromDB.PairID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every session of the user and denylists their last issued access tokens.
+func (s *Service) LogoutAll(ctx context.Context, claims *auth.IndividualRequirements) (err error) {
+	const op = "service.LogoutAll"
+
+	ctx, done := startSpan(ctx, "service.LogoutAll")
+	defer func() { done(err) }()
+
+	sessions, err := s.storage.GetSessionsByUser(ctx, claims.Subject)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	if err := s.storage.DeleteTokensByUser(ctx, claims.Subject); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	timeNow := time.Now()
+
+	for _, session := range sessions {
+		expiresAt := session.CreatedTime.Add(s.config.AccessTokenTTL)
+		if session.PairID == "" || expiresAt.Before(timeNow) {
+			continue
+		}
+
+		if err := s.storage.DenyAccessToken(ctx, session.PairID, expiresAt); err != nil {
+			return fmt.Errorf("%s: %w", op, storageError(err))
+		}
+	}
+
+	if err := s.storage.DenyAccessToken(ctx, claims.GUID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	return nil
+}
+
 func (s *Service) RefreshToken(userName string) (string, error) {
 	const op = "service.RefreshToken"
 
@@ -60,101 +263,314 @@ func (s *Service) RefreshToken(userName string) (string, error) {
 	return refreshToken, nil
 }
 
-func (s *Service) TakeValidToken(tokenFromHeader string, userName string) bool {
-	tokenFromDB, err := s.getTokenFromDB(userName)
+func (s *Service) TakeValidToken(ctx context.Context, tokenFromHeader string, accessToken string, userName string, ip string) (err error) {
+	const op = "service.TakeValidToken"
+
+	ctx, done := startSpan(ctx, "service.TakeValidToken")
+	defer func() { done(err) }()
+
+	refreshToken, tokenFromDB, err := s.getTokenFromDB(ctx, tokenFromHeader, userName)
 	if err != nil {
-		return false
+		return s.fail(fmt.Errorf("%s: %w", op, err))
+	}
+
+	if ok := s.tokenAuthenticator.CompareTokens(refreshToken.Secret, []byte(tokenFromDB.RefreshToken)); !ok {
+		return s.fail(fmt.Errorf("%s: %w", op, ErrTokenInvalid))
+	}
+
+	if err := s.checkReuse(ctx, tokenFromDB, ip); err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, err))
+	}
+
+	if err := s.checkPairID(tokenFromDB, accessToken, userName); err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, err))
 	}
 
-	if ok := s.tokenAuthenticator.CompareTokens(tokenFromHeader, []byte(tokenFromDB)); !ok {
-		return false
+	if err := s.checkTokenTtl(ctx, tokenFromDB, time.Now()); err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, err))
 	}
 
-	if ok, err := s.checkTokenTtl(tokenFromDB, userName, time.Now()); err != nil || !ok {
-		return false
+	if err := s.checkIP(ctx, tokenFromDB, ip); err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, err))
 	}
 
-	return true
+	return nil
 }
 
-func (s *Service) checkTokenTtl(tokenFromDB string, userName string, time time.Time) (bool, error) {
-	const op = "service.checkTokenTtl"
+// checkReuse revokes the whole token family when an already rotated token is presented again.
+func (s *Service) checkReuse(ctx context.Context, tokenFromDB models.User, ip string) error {
+	const op = "service.checkReuse"
+
+	if !tokenFromDB.Used {
+		return nil
+	}
+
+	if err := s.storage.RevokeFamily(ctx, tokenFromDB.FamilyID); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	s.emitTokenReused(ctx, TokenReusedEvent{
+		UserName: tokenFromDB.Name,
+		TokenID:  tokenFromDB.TokenID,
+		FamilyID: tokenFromDB.FamilyID,
+		IP:       ip,
+		UsedTime: tokenFromDB.UsedTime,
+		Time:     time.Now(),
+	})
+
+	return fmt.Errorf("%s: %w", op, ErrTokenReused)
+}
+
+func (s *Service) emitTokenReused(ctx context.Context, event TokenReusedEvent) {
+	s.metrics.TokenReused()
+
+	s.log.WarnContext(
+		ctx,
+		"Refresh token reused, token family revoked",
+		slog.String("user_name", event.UserName),
+		slog.String("token_id", event.TokenID),
+		slog.String("family_id", event.FamilyID),
+		slog.String("ip", event.IP),
+		slog.Time("used_time", event.UsedTime),
+		slog.Time("time", event.Time))
+}
+
+// checkIP reports an IP change and fails only when config.Sessions.RejectIPChange is set.
+func (s *Service) checkIP(ctx context.Context, tokenFromDB models.User, ip string) error {
+	const op = "service.checkIP"
+
+	if tokenFromDB.IP == ip {
+		return nil
+	}
+
+	s.emitIPChanged(ctx, IPChangedEvent{
+		UserName:   tokenFromDB.Name,
+		PreviousIP: tokenFromDB.IP,
+		CurrentIP:  ip,
+		Time:       time.Now(),
+	})
+
+	if s.config.Sessions.RejectIPChange {
+		return fmt.Errorf("%s: %w", op, ErrIPMismatch)
+	}
+
+	return nil
+}
+
+func (s *Service) emitIPChanged(ctx context.Context, event IPChangedEvent) {
+	s.metrics.IPChanged()
+
+	s.log.WarnContext(
+		ctx,
+		"IP changed",
+		slog.String("user_name", event.UserName),
+		slog.String("previous_ip", event.PreviousIP),
+		slog.String("current_ip", event.CurrentIP),
+		slog.Time("time", event.Time))
+
+	if err := s.sendIPChangedWarning(ctx, event); err != nil {
+		s.log.ErrorContext(ctx, "Fail of sending IP change warning", slog.String("user_name", event.UserName), sl.Err(err))
+	}
+}
 
-	createdTime, err := s.storage.GetTime(context.TODO(), tokenFromDB, userName)
+func (s *Service) sendIPChangedWarning(ctx context.Context, event IPChangedEvent) error {
+	const op = "service.sendIPChangedWarning"
+
+	email, err := s.storage.GetEmail(ctx, event.UserName)
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	msg := notifier.Message{
+		To:      email,
+		Subject: "Security warning: new sign-in IP address",
+		Body: fmt.Sprintf(
+			"Your session was refreshed from a new IP address.\n\nPrevious IP: %s\nCurrent IP: %s\nTime: %s\n\nIf this was not you, contact support.",
+			event.PreviousIP, event.CurrentIP, event.Time.UTC().Format(time.RFC3339)),
+	}
+
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if createdTime.Add(s.config.JWT.RefreshTokenTTL).Before(time) {
-		if err := s.storage.DeleteToken(context.TODO(), tokenFromDB); err != nil {
-			return false, fmt.Errorf("%s: %w", op, err)
+	return nil
+}
+
+func (s *Service) checkTokenTtl(ctx context.Context, tokenFromDB models.User, time time.Time) error {
+	const op = "service.checkTokenTtl"
+
+	if tokenFromDB.CreatedTime.Add(s.config.JWT.RefreshTokenTTL).Before(time) {
+		if err := s.storage.DeleteToken(ctx, tokenFromDB.TokenID); err != nil {
+			return fmt.Errorf("%s: %w", op, storageError(err))
 		}
 
-		return false, nil
+		return fmt.Errorf("%s: %w", op, ErrTokenExpired)
+	}
+
+	return nil
+}
+
+func (s *Service) checkPairID(tokenFromDB models.User, accessToken string, userName string) error {
+	const op = "service.checkPairID"
+
+	pairID, err := s.tokenAuthenticator.GetPairID(accessToken, userName)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrAccessTokenInvalid, err)
+	}
+
+	if pairID != tokenFromDB.PairID {
+		return fmt.Errorf("%s: %w", op, ErrPairMismatch)
 	}
 
-	return true, nil
+	return nil
 }
 
-func (s *Service) getTokenFromDB(userName string) (string, error) {
+func (s *Service) getTokenFromDB(ctx context.Context, tokenFromHeader string, userName string) (auth.RefreshToken, models.User, error) {
 	const op = "service.getTokenFromDB"
 
-	refreshTokenFromDB, err := s.storage.GetTokenByUser(context.Background(), userName)
+	refreshToken, err := s.tokenAuthenticator.ParseRefreshToken(tokenFromHeader)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return auth.RefreshToken{}, models.User{}, fmt.Errorf("%s: %w: %w", op, ErrTokenInvalid, err)
+	}
+
+	tokenFromDB, err := s.storage.GetTokenByID(ctx, refreshToken.ID)
+	if errors.Is(err, storage.ErrTokenNotFound) {
+		return auth.RefreshToken{}, models.User{}, fmt.Errorf("%s: %w: %w", op, ErrTokenNotFound, auth.ErrUnknownToken)
+	}
+	if err != nil {
+		return auth.RefreshToken{}, models.User{}, fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	if tokenFromDB.Name != userName {
+		return auth.RefreshToken{}, models.User{}, fmt.Errorf("%s: %w: %w", op, ErrTokenNotFound, auth.ErrUnknownToken)
 	}
 
-	return refreshTokenFromDB, nil
+	return refreshToken, tokenFromDB, nil
 }
 
-func (s *Service) SelectToken(CreateObjectToken string, userName string) error {
+func (s *Service) SelectToken(ctx context.Context, oldToken string, CreateObjectToken string, userName string, pairID string, ip string) (err error) {
 	const op = "service.switchToken"
 
-	oldToken, err := s.getTokenFromDB(userName)
+	ctx, done := startSpan(ctx, "service.SelectToken")
+	defer func() { done(err) }()
+
+	oldRefreshToken, err := s.tokenAuthenticator.ParseRefreshToken(oldToken)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return s.fail(fmt.Errorf("%s: %w: %w", op, ErrTokenInvalid, err))
 	}
 
-	hashedToken, err := s.tokenAuthenticator.HashToken(CreateObjectToken)
+	oldTokenFromDB, err := s.storage.GetTokenByID(ctx, oldRefreshToken.ID)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return s.fail(fmt.Errorf("%s: %w", op, storageError(err)))
 	}
 
-	if err := s.storage.SelectToken(context.TODO(), oldToken, string(hashedToken), userName, time.Now()); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	token, err := s.makeTokenRecord(CreateObjectToken, models.User{
+		Name:               userName,
+		PairID:             pairID,
+		FamilyID:           oldTokenFromDB.FamilyID,
+		Device:             oldTokenFromDB.Device,
+		IP:                 ip,
+		SessionCreatedTime: oldTokenFromDB.SessionCreatedTime,
+	})
+	if err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, err))
 	}
 
+	if err := s.storage.SelectToken(ctx, oldRefreshToken.ID, token); err != nil {
+		return s.fail(fmt.Errorf("%s: %w", op, storageError(err)))
+	}
+
+	s.metrics.TokenRefreshed()
+
 	return nil
 }
 
-func (s *Service) CheckCountTokens(userName string) error {
+// CheckCountTokens enforces config.Sessions.MaxPerUser before a new session is opened.
+// A MaxPerUser below one means no limit.
+func (s *Service) CheckCountTokens(ctx context.Context, userName string) (err error) {
 	const op = "service.CheckCountTokens"
 
-	count, err := s.storage.CountTokens(context.TODO(), userName)
+	ctx, done := startSpan(ctx, "service.CheckCountTokens")
+	defer func() { done(err) }()
+
+	maxSessions := int64(s.config.Sessions.MaxPerUser)
+	if maxSessions <= 0 {
+		return nil
+	}
+
+	count, err := s.storage.CountTokens(ctx, userName)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	if count < maxSessions {
+		return nil
+	}
+
+	if s.config.Sessions.Eviction == config.EvictionReject {
+		return s.fail(fmt.Errorf("%s: %w", op, ErrTooManySessions))
 	}
 
-	if count > 0 {
-		if err := s.storage.DeleteTokensByUser(context.TODO(), userName); err != nil {
-			return fmt.Errorf("%s: %w", op, err)
+	sessions, err := s.storage.GetSessionsByUser(ctx, userName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
+	}
+
+	for i := 0; i < len(sessions) && int64(len(sessions)-i) >= maxSessions; i++ {
+		if err := s.storage.RevokeFamily(ctx, sessions[i].FamilyID); err != nil {
+			return fmt.Errorf("%s: %w", op, storageError(err))
 		}
 	}
 
 	return nil
 }
 
-func (s *Service) InsertToken(refreshToken string, userName string) error {
+func (s *Service) InsertToken(ctx context.Context, refreshToken string, userName string, pairID string, ip string, device string) (err error) {
 	const op = "service.InsertToken"
 
-	hashedToken, err := s.tokenAuthenticator.HashToken(refreshToken)
+	ctx, done := startSpan(ctx, "service.InsertToken")
+	defer func() { done(err) }()
+
+	timeNow := time.Now()
+
+	token, err := s.makeTokenRecord(refreshToken, models.User{
+		Name:               userName,
+		PairID:             pairID,
+		FamilyID:           uuid.New().String(),
+		Device:             device,
+		IP:                 ip,
+		SessionCreatedTime: timeNow,
+	})
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.storage.InsertToken(context.TODO(), userName, string(hashedToken), time.Now()); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	if err := s.storage.InsertToken(ctx, token); err != nil {
+		return fmt.Errorf("%s: %w", op, storageError(err))
 	}
 
 	return nil
 }
+
+func (s *Service) makeTokenRecord(refreshToken string, session models.User) (models.User, error) {
+	const op = "service.makeTokenRecord"
+
+	parsedToken, err := s.tokenAuthenticator.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	start := time.Now()
+	hashedToken, err := s.tokenAuthenticator.HashToken(parsedToken.Secret)
+	s.metrics.ObserveHash(time.Since(start))
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.TokenID = parsedToken.ID
+	session.RefreshToken = string(hashedToken)
+	session.CreatedTime = time.Now()
+	session.ExpiresTime = session.CreatedTime.Add(s.config.JWT.RefreshTokenTTL)
+
+	return session, nil
+}
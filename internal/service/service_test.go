@@ -0,0 +1,498 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/notifier"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/exp/slog"
+)
+
+type fakeMetrics struct {
+	mu        sync.Mutex
+	issued    int
+	refreshed int
+	reused    int
+	ipChanged int
+	hashes    int
+	failures  []string
+}
+
+func (m *fakeMetrics) TokenIssued() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issued++
+}
+
+func (m *fakeMetrics) TokenRefreshed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshed++
+}
+
+func (m *fakeMetrics) TokenFailed(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, reason)
+}
+
+func (m *fakeMetrics) TokenReused() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reused++
+}
+
+func (m *fakeMetrics) IPChanged() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ipChanged++
+}
+
+func (m *fakeMetrics) ObserveHash(time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hashes++
+}
+
+func createObjectTestService(t *testing.T) *Service {
+	cfg := &config.Config{
+		JWT: config.JWT{
+			AccessTokenTTL:  time.Minute,
+			RefreshTokenTTL: time.Hour,
+		},
+		Sessions: config.Sessions{
+			MaxPerUser: 2,
+			Eviction:   config.EvictionOldest,
+		},
+	}
+
+	tokenAuthenticator, err := auth.CreateObject("12345", "67890")
+	require.NoError(t, err)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := memory.CreateObjectStorage().CreateObjectRefreshRepo()
+
+	s, err := CreateObject(cfg, storage, tokenAuthenticator, CreateObjectProfileClaims(storage), notifier.CreateObjectNoop(), &fakeMetrics{}, log)
+	require.NoError(t, err)
+
+	return s
+}
+
+func login(t *testing.T, s *Service, userName string) (string, string) {
+	ctx := context.Background()
+
+	require.NoError(t, s.CheckCountTokens(ctx, userName))
+
+	pairID := s.CreateObjectPairID()
+
+	refreshToken, err := s.RefreshToken(userName)
+	require.NoError(t, err)
+	require.NoError(t, s.InsertToken(ctx, refreshToken, userName, pairID, "127.0.0.1", "device"))
+
+	accessToken, err := s.MakeAccessToken(ctx, userName, pairID, "127.0.0.1")
+	require.NoError(t, err)
+
+	return refreshToken, accessToken
+}
+
+// rotate exchanges refreshToken for a new pair the way the refresh handler does.
+func rotate(t *testing.T, s *Service, refreshToken string) (string, string) {
+	ctx := context.Background()
+
+	pairID := s.CreateObjectPairID()
+
+	newRefreshToken, err := s.RefreshToken("user")
+	require.NoError(t, err)
+	require.NoError(t, s.SelectToken(ctx, refreshToken, newRefreshToken, "user", pairID, "127.0.0.1"))
+
+	accessToken, err := s.MakeAccessToken(ctx, "user", pairID, "127.0.0.1")
+	require.NoError(t, err)
+
+	return newRefreshToken, accessToken
+}
+
+func tokenID(t *testing.T, s *Service, refreshToken string) string {
+	parsed, err := s.tokenAuthenticator.ParseRefreshToken(refreshToken)
+	require.NoError(t, err)
+
+	return parsed.ID
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"))
+
+	_, otherAccessToken := login(t, s, "user")
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, otherAccessToken, "user", "127.0.0.1"), ErrPairMismatch)
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "another", "127.0.0.1"), ErrTokenNotFound)
+	require.ErrorIs(t, s.TakeValidToken(ctx, "garbage", accessToken, "user", "127.0.0.1"), ErrTokenInvalid)
+
+	pairID := s.CreateObjectPairID()
+	newRefreshToken, err := s.RefreshToken("user")
+	require.NoError(t, err)
+	require.NoError(t, s.SelectToken(ctx, refreshToken, newRefreshToken, "user", pairID, "127.0.0.1"))
+
+	newAccessToken, err := s.MakeAccessToken(ctx, "user", pairID, "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, s.TakeValidToken(ctx, newRefreshToken, newAccessToken, "user", "127.0.0.1"))
+
+	err = s.SelectToken(ctx, refreshToken, newRefreshToken, "user", pairID, "127.0.0.1")
+	require.ErrorIs(t, err, ErrTokenAlreadyRotated)
+}
+
+func TestSelectTokenConcurrentRotation(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, _ := login(t, s, "user")
+
+	const rotations = 2
+
+	newRefreshTokens := make([]string, rotations)
+	for i := range newRefreshTokens {
+		token, err := s.RefreshToken("user")
+		require.NoError(t, err)
+
+		newRefreshTokens[i] = token
+	}
+
+	errs := make([]error, rotations)
+
+	var wg sync.WaitGroup
+	for i := 0; i < rotations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			errs[i] = s.SelectToken(ctx, refreshToken, newRefreshTokens[i], "user", s.CreateObjectPairID(), "127.0.0.1")
+		}(i)
+	}
+	wg.Wait()
+
+	var rotated, rejected int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case errors.Is(err, ErrTokenAlreadyRotated):
+			rejected++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	require.Equal(t, 1, rotated)
+	require.Equal(t, 1, rejected)
+	require.Equal(t, []string{"token_already_rotated"}, s.metrics.(*fakeMetrics).failures)
+
+	count, err := s.storage.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+
+	pairID := s.CreateObjectPairID()
+	newRefreshToken, err := s.RefreshToken("user")
+	require.NoError(t, err)
+	require.NoError(t, s.SelectToken(ctx, refreshToken, newRefreshToken, "user", pairID, "127.0.0.1"))
+
+	newAccessToken, err := s.MakeAccessToken(ctx, "user", pairID, "127.0.0.1")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"), ErrTokenReused)
+	require.ErrorIs(t, s.TakeValidToken(ctx, newRefreshToken, newAccessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+}
+
+func TestRefreshTokenReuseRevokesOnlyFamily(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	otherRefreshToken, otherAccessToken := login(t, s, "user")
+
+	first, _ := rotate(t, s, refreshToken)
+	second, secondAccessToken := rotate(t, s, first)
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, first, accessToken, "user", "127.0.0.1"), ErrTokenReused)
+
+	for _, token := range []string{refreshToken, first, second} {
+		_, err := s.storage.GetTokenByID(ctx, tokenID(t, s, token))
+		require.ErrorIs(t, err, storage.ErrTokenNotFound)
+	}
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, second, secondAccessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+	require.NoError(t, s.TakeValidToken(ctx, otherRefreshToken, otherAccessToken, "user", "127.0.0.1"))
+}
+
+func TestCheckCountTokens(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	first, firstAccessToken := login(t, s, "user")
+	second, secondAccessToken := login(t, s, "user")
+	third, thirdAccessToken := login(t, s, "user")
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, first, firstAccessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+	require.NoError(t, s.TakeValidToken(ctx, second, secondAccessToken, "user", "127.0.0.1"))
+	require.NoError(t, s.TakeValidToken(ctx, third, thirdAccessToken, "user", "127.0.0.1"))
+
+	s.config.Sessions.Eviction = config.EvictionReject
+	require.ErrorIs(t, s.CheckCountTokens(ctx, "user"), ErrTooManySessions)
+}
+
+func TestCheckCountTokensIgnoresExpiredSessions(t *testing.T) {
+	ctx := context.Background()
+
+	insertSession := func(t *testing.T, s *Service, sessionCreatedTime time.Time, expiresTime time.Time) {
+		require.NoError(t, s.storage.InsertToken(ctx, models.User{
+			Name:               "user",
+			TokenID:            uuid.New().String(),
+			FamilyID:           uuid.New().String(),
+			CreatedTime:        expiresTime.Add(-s.config.JWT.RefreshTokenTTL),
+			SessionCreatedTime: sessionCreatedTime,
+			ExpiresTime:        expiresTime,
+		}))
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		s := createObjectTestService(t)
+		s.config.Sessions.Eviction = config.EvictionReject
+
+		for i := 0; i < s.config.Sessions.MaxPerUser; i++ {
+			insertSession(t, s, time.Now().Add(-3*time.Hour), time.Now().Add(-time.Hour))
+		}
+
+		require.NoError(t, s.CheckCountTokens(ctx, "user"))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		s := createObjectTestService(t)
+		s.config.Sessions.Eviction = config.EvictionReject
+		s.config.Sessions.MaxPerUser = -1
+
+		for i := 0; i < 5; i++ {
+			insertSession(t, s, time.Now(), time.Now().Add(time.Hour))
+		}
+
+		require.NoError(t, s.CheckCountTokens(ctx, "user"))
+	})
+
+	t.Run("oldest", func(t *testing.T) {
+		s := createObjectTestService(t)
+
+		// A session started long ago but refreshed recently is older than a session that expired unused.
+		pairID := s.CreateObjectPairID()
+		refreshToken, err := s.RefreshToken("user")
+		require.NoError(t, err)
+
+		token, err := s.makeTokenRecord(refreshToken, models.User{
+			Name:               "user",
+			PairID:             pairID,
+			FamilyID:           uuid.New().String(),
+			SessionCreatedTime: time.Now().Add(-3 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.storage.InsertToken(ctx, token))
+
+		accessToken, err := s.MakeAccessToken(ctx, "user", pairID, "127.0.0.1")
+		require.NoError(t, err)
+
+		insertSession(t, s, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+
+		login(t, s, "user")
+
+		require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"))
+	})
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	otherRefreshToken, otherAccessToken := login(t, s, "user")
+
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Logout(ctx, refreshToken, claims))
+
+	_, err = s.ParseAccessToken(ctx, accessToken)
+	require.ErrorIs(t, err, ErrAccessTokenRevoked)
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+	require.ErrorIs(t, s.Logout(ctx, refreshToken, claims), ErrTokenNotFound)
+
+	_, err = s.ParseAccessToken(ctx, otherAccessToken)
+	require.NoError(t, err)
+	require.NoError(t, s.TakeValidToken(ctx, otherRefreshToken, otherAccessToken, "user", "127.0.0.1"))
+}
+
+func TestLogoutOtherUsersToken(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	_, otherAccessToken := login(t, s, "other")
+
+	otherClaims, err := s.ParseAccessToken(ctx, otherAccessToken)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.Logout(ctx, refreshToken, otherClaims), ErrTokenNotFound)
+	require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"))
+}
+
+func TestLogoutPairMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	otherRefreshToken, otherAccessToken := login(t, s, "user")
+
+	otherClaims, err := s.ParseAccessToken(ctx, otherAccessToken)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.Logout(ctx, refreshToken, otherClaims), ErrPairMismatch)
+
+	for _, token := range []string{accessToken, otherAccessToken} {
+		_, err := s.ParseAccessToken(ctx, token)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"))
+	require.NoError(t, s.TakeValidToken(ctx, otherRefreshToken, otherAccessToken, "user", "127.0.0.1"))
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	secondRefreshToken, secondAccessToken := login(t, s, "user")
+	otherRefreshToken, otherAccessToken := login(t, s, "other")
+
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, s.LogoutAll(ctx, claims))
+
+	for _, token := range []string{accessToken, secondAccessToken} {
+		_, err := s.ParseAccessToken(ctx, token)
+		require.ErrorIs(t, err, ErrAccessTokenRevoked)
+	}
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+	require.ErrorIs(t, s.TakeValidToken(ctx, secondRefreshToken, secondAccessToken, "user", "127.0.0.1"), ErrTokenNotFound)
+
+	_, err = s.ParseAccessToken(ctx, otherAccessToken)
+	require.NoError(t, err)
+	require.NoError(t, s.TakeValidToken(ctx, otherRefreshToken, otherAccessToken, "other", "127.0.0.1"))
+}
+
+func TestTakeValidTokenIPChange(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "10.0.0.1"))
+
+	s.config.Sessions.RejectIPChange = true
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "10.0.0.1"), ErrIPMismatch)
+}
+
+func TestTakeValidTokenExpired(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+
+	s.config.JWT.RefreshTokenTTL = -time.Second
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"), ErrTokenExpired)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	s := createObjectTestService(t)
+	metrics := s.metrics.(*fakeMetrics)
+
+	refreshToken, accessToken := login(t, s, "user")
+	require.Equal(t, 1, metrics.issued)
+	require.Equal(t, 1, metrics.hashes)
+
+	require.NoError(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "10.0.0.1"))
+	require.Equal(t, 1, metrics.ipChanged)
+
+	newRefreshToken, err := s.RefreshToken("user")
+	require.NoError(t, err)
+	require.NoError(t, s.SelectToken(ctx, refreshToken, newRefreshToken, "user", s.CreateObjectPairID(), "127.0.0.1"))
+	require.Equal(t, 1, metrics.refreshed)
+	require.Equal(t, 2, metrics.hashes)
+
+	require.ErrorIs(t, s.TakeValidToken(ctx, "garbage", accessToken, "user", "127.0.0.1"), ErrTokenInvalid)
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "user", "127.0.0.1"), ErrTokenReused)
+	require.Equal(t, 1, metrics.reused)
+	require.Equal(t, []string{"token_invalid", "token_reused"}, metrics.failures)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+
+	s := createObjectTestService(t)
+
+	refreshToken, accessToken := login(t, s, "user")
+	require.ErrorIs(t, s.TakeValidToken(ctx, refreshToken, accessToken, "another", "127.0.0.1"), ErrTokenNotFound)
+
+	parent.End()
+
+	var span sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "service.TakeValidToken" {
+			span = ended
+		}
+	}
+
+	require.NotNil(t, span)
+	require.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	require.Equal(t, codes.Error, span.Status().Code)
+	require.NotEmpty(t, span.Events())
+}
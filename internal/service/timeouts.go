@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+)
+
+// detachedWriteTimeout bounds the writes that outlive the request when the write timeout is disabled.
+const detachedWriteTimeout = 10 * time.Second
+
+// TimeoutStorage bounds every call to the wrapped storage by the read or write timeout,
+// on top of the deadline the request context already has.
+type TimeoutStorage struct {
+	storage  Storage
+	timeouts config.StorageTimeouts
+}
+
+func CreateObjectTimeoutStorage(storage Storage, timeouts config.StorageTimeouts) *TimeoutStorage {
+	return &TimeoutStorage{
+		storage:  storage,
+		timeouts: timeouts,
+	}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (t *TimeoutStorage) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.timeouts.Read)
+}
+
+func (t *TimeoutStorage) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.timeouts.Write)
+}
+
+// detachedWrite is not cancelled with the request, only by its own timeout.
+func (t *TimeoutStorage) detachedWrite(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := t.timeouts.Write
+	if timeout <= 0 {
+		timeout = detachedWriteTimeout
+	}
+
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+func (t *TimeoutStorage) InsertToken(ctx context.Context, token models.User) error {
+	ctx, cancel := t.write(ctx)
+	defer cancel()
+
+	return t.storage.InsertToken(ctx, token)
+}
+
+func (t *TimeoutStorage) DeleteToken(ctx context.Context, tokenID string) error {
+	ctx, cancel := t.write(ctx)
+	defer cancel()
+
+	return t.storage.DeleteToken(ctx, tokenID)
+}
+
+func (t *TimeoutStorage) DeleteTokensByUser(ctx context.Context, userName string) error {
+	ctx, cancel := t.write(ctx)
+	defer cancel()
+
+	return t.storage.DeleteTokensByUser(ctx, userName)
+}
+
+// SelectToken finishes even if the client goes away: a rotation cut short after the old token
+// is marked used would make the retry look like reuse and revoke the whole family.
+func (t *TimeoutStorage) SelectToken(ctx context.Context, oldTokenID string, token models.User) error {
+	ctx, cancel := t.detachedWrite(ctx)
+	defer cancel()
+
+	return t.storage.SelectToken(ctx, oldTokenID, token)
+}
+
+func (t *TimeoutStorage) RevokeFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := t.write(ctx)
+	defer cancel()
+
+	return t.storage.RevokeFamily(ctx, familyID)
+}
+
+func (t *TimeoutStorage) CountTokens(ctx context.Context, userName string) (int64, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.CountTokens(ctx, userName)
+}
+
+func (t *TimeoutStorage) GetTokenByID(ctx context.Context, tokenID string) (models.User, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.GetTokenByID(ctx, tokenID)
+}
+
+func (t *TimeoutStorage) GetSessionsByUser(ctx context.Context, userName string) ([]models.User, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.GetSessionsByUser(ctx, userName)
+}
+
+func (t *TimeoutStorage) GetEmail(ctx context.Context, userName string) (string, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.GetEmail(ctx, userName)
+}
+
+func (t *TimeoutStorage) GetProfile(ctx context.Context, userName string) (models.Profile, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.GetProfile(ctx, userName)
+}
+
+func (t *TimeoutStorage) DenyAccessToken(ctx context.Context, accessTokenGUID string, expiresAt time.Time) error {
+	ctx, cancel := t.write(ctx)
+	defer cancel()
+
+	return t.storage.DenyAccessToken(ctx, accessTokenGUID, expiresAt)
+}
+
+func (t *TimeoutStorage) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error) {
+	ctx, cancel := t.read(ctx)
+	defer cancel()
+
+	return t.storage.IsAccessTokenDenied(ctx, accessTokenGUID)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/notifier"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+// blockingStorage holds every lookup until the context is done, like a stuck database.
+type blockingStorage struct {
+	Storage
+	called   chan struct{}
+	deadline bool
+}
+
+func (b *blockingStorage) GetTokenByID(ctx context.Context, tokenID string) (models.User, error) {
+	_, b.deadline = ctx.Deadline()
+	close(b.called)
+	<-ctx.Done()
+
+	return models.User{}, ctx.Err()
+}
+
+func (b *blockingStorage) SelectToken(ctx context.Context, oldTokenID string, token models.User) error {
+	_, b.deadline = ctx.Deadline()
+
+	return ctx.Err()
+}
+
+func (b *blockingStorage) CountTokens(ctx context.Context, userName string) (int64, error) {
+	_, b.deadline = ctx.Deadline()
+
+	return 0, nil
+}
+
+func TestTimeoutStorage(t *testing.T) {
+	blocking := &blockingStorage{called: make(chan struct{})}
+	s := CreateObjectTimeoutStorage(blocking, config.StorageTimeouts{Read: 10 * time.Millisecond})
+
+	_, err := s.GetTokenByID(context.Background(), "token")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, blocking.deadline)
+
+	for _, timeouts := range []config.StorageTimeouts{{}, {Read: -1, Write: -1}} {
+		s = CreateObjectTimeoutStorage(blocking, timeouts)
+
+		_, err = s.CountTokens(context.Background(), "user")
+		require.NoError(t, err)
+		require.False(t, blocking.deadline)
+	}
+}
+
+func TestRotationOutlivesRequest(t *testing.T) {
+	blocking := &blockingStorage{called: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, timeouts := range []config.StorageTimeouts{{Write: time.Minute}, {}, {Write: -1}} {
+		s := CreateObjectTimeoutStorage(blocking, timeouts)
+
+		blocking.deadline = false
+
+		require.NoError(t, s.SelectToken(ctx, "old", models.User{TokenID: "new"}))
+		require.True(t, blocking.deadline)
+	}
+}
+
+func TestCancelledRequestAbortsStorage(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWT{
+			AccessTokenTTL:  time.Minute,
+			RefreshTokenTTL: time.Hour,
+		},
+	}
+
+	tokenAuthenticator, err := auth.CreateObject("12345", "67890")
+	require.NoError(t, err)
+
+	blocking := &blockingStorage{called: make(chan struct{})}
+	storage := CreateObjectTimeoutStorage(blocking, config.StorageTimeouts{Read: time.Minute})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	s, err := CreateObject(cfg, storage, tokenAuthenticator, nil, notifier.CreateObjectNoop(), &fakeMetrics{}, log)
+	require.NoError(t, err)
+
+	refreshToken, err := s.RefreshToken("user")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.TakeValidToken(ctx, refreshToken, "access", "user", "127.0.0.1")
+	}()
+
+	<-blocking.called
+	cancel()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, err, ErrStorageUnavailable)
+	case <-time.After(time.Second):
+		t.Fatal("storage call was not aborted")
+	}
+}
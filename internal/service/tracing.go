@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// tracerName is resolved on every span, so a tracer provider set later is picked up.
+const tracerName = "github.com/DarRo9/Test-task-BackDev/internal/service"
+
+// startSpan starts a span for a service method. The returned func ends it and marks it failed when err is set.
+func startSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name)
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+)
+
+type RefreshRepo struct {
+	mu       sync.RWMutex
+	tokens   map[string]models.User
+	profiles map[string]models.Profile
+	denylist map[string]time.Time
+	now      func() time.Time
+}
+
+type Storage struct {
+	now func() time.Time
+}
+
+func (r *RefreshRepo) DeleteToken(ctx context.Context, tokenID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tokens, tokenID)
+
+	return nil
+}
+
+func (r *RefreshRepo) InsertToken(ctx context.Context, token models.User) error {
+	const op = "storage.memory.InsertToken"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pruneTokens()
+
+	if err := r.insertToken(token); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.Name == userName {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) GetTokenByID(ctx context.Context, tokenID string) (models.User, error) {
+	const op = "storage.memory.GetTokenByID"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	token, ok := r.tokens[tokenID]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+
+	return token, nil
+}
+
+func (r *RefreshRepo) SelectToken(ctx context.Context, oldTokenID string, token models.User) error {
+	const op = "storage.memory.SelectToken"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldToken, ok := r.tokens[oldTokenID]
+	if !ok || oldToken.Used {
+		return fmt.Errorf("%s: %w", op, storage.ErrTokenAlreadyRotated)
+	}
+
+	if err := r.insertToken(token); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	oldToken.Used = true
+	oldToken.UsedTime = token.CreatedTime
+	r.tokens[oldTokenID] = oldToken
+
+	r.pruneTokens()
+
+	return nil
+}
+
+func (r *RefreshRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.FamilyID == familyID {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+// GetSessionsByUser returns the unused tokens of the user that have not expired yet.
+func (r *RefreshRepo) GetSessionsByUser(ctx context.Context, userName string) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+
+	var sessions []models.User
+	for _, token := range r.tokens {
+		if token.Name == userName && !token.Used && !token.Expired(now) {
+			sessions = append(sessions, token)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SessionCreatedTime.Before(sessions[j].SessionCreatedTime)
+	})
+
+	return sessions, nil
+}
+
+func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+
+	var count int64
+	for _, token := range r.tokens {
+		if token.Name == userName && !token.Used && !token.Expired(now) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *RefreshRepo) GetEmail(ctx context.Context, userName string) (string, error) {
+	const op = "storage.memory.GetEmail"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profile, ok := r.profiles[userName]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+
+	return profile.Email, nil
+}
+
+func (r *RefreshRepo) GetProfile(ctx context.Context, userName string) (models.Profile, error) {
+	const op = "storage.memory.GetProfile"
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profile, ok := r.profiles[userName]
+	if !ok {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+
+	profile.Roles = slices.Clone(profile.Roles)
+
+	return profile, nil
+}
+
+func (r *RefreshRepo) InsertProfile(ctx context.Context, profile models.Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	profile.Roles = slices.Clone(profile.Roles)
+	r.profiles[profile.Name] = profile
+
+	return nil
+}
+
+// DenyAccessToken keeps the entry until expiresAt, like a TTL index would.
+func (r *RefreshRepo) DenyAccessToken(ctx context.Context, accessTokenGUID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pruneDenylist()
+	r.denylist[accessTokenGUID] = expiresAt
+
+	return nil
+}
+
+func (r *RefreshRepo) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	expiresAt, ok := r.denylist[accessTokenGUID]
+
+	return ok && expiresAt.After(r.now()), nil
+}
+
+func (r *RefreshRepo) insertToken(token models.User) error {
+	if _, ok := r.tokens[token.TokenID]; ok {
+		return fmt.Errorf("duplicate token id %q", token.TokenID)
+	}
+
+	r.tokens[token.TokenID] = token
+
+	return nil
+}
+
+// pruneTokens drops expired tokens, used or not, like the TTL index on expires_time.
+func (r *RefreshRepo) pruneTokens() {
+	now := r.now()
+
+	for id, token := range r.tokens {
+		if token.Expired(now) {
+			delete(r.tokens, id)
+		}
+	}
+}
+
+func (r *RefreshRepo) pruneDenylist() {
+	now := r.now()
+
+	for guid, expiresAt := range r.denylist {
+		if !expiresAt.After(now) {
+			delete(r.denylist, guid)
+		}
+	}
+}
+
+func CreateObjectStorage() *Storage {
+	return CreateObjectStorageWithClock(time.Now)
+}
+
+// CreateObjectStorageWithClock uses now instead of the wall clock to expire tokens and denylist entries.
+func CreateObjectStorageWithClock(now func() time.Time) *Storage {
+	return &Storage{now: now}
+}
+
+func (s *Storage) CreateObjectRefreshRepo() *RefreshRepo {
+	return &RefreshRepo{
+		tokens:   make(map[string]models.User),
+		profiles: make(map[string]models.Profile),
+		denylist: make(map[string]time.Time),
+		now:      s.now,
+	}
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return CreateObjectStorage().CreateObjectRefreshRepo()
+	})
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestExpiredTokensArePruned(t *testing.T) {
+	ctx := context.Background()
+
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	refreshRepo := CreateObjectStorageWithClock(c.Now).CreateObjectRefreshRepo()
+
+	expiring := models.User{Name: "user", TokenID: "expiring", ExpiresTime: c.now.Add(time.Hour)}
+	legacy := models.User{Name: "user", TokenID: "legacy"}
+
+	require.NoError(t, refreshRepo.InsertToken(ctx, expiring))
+	require.NoError(t, refreshRepo.InsertToken(ctx, legacy))
+
+	count, err := refreshRepo.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	c.now = c.now.Add(time.Hour)
+
+	count, err = refreshRepo.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	sessions, err := refreshRepo.GetSessionsByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, "legacy", sessions[0].TokenID)
+
+	require.NoError(t, refreshRepo.InsertToken(ctx, models.User{Name: "other", TokenID: "next", ExpiresTime: c.now.Add(time.Hour)}))
+
+	_, err = refreshRepo.GetTokenByID(ctx, "expiring")
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = refreshRepo.GetTokenByID(ctx, "legacy")
+	require.NoError(t, err)
+}
+
+func TestDeniedAccessTokenExpires(t *testing.T) {
+	ctx := context.Background()
+
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	refreshRepo := CreateObjectStorageWithClock(c.Now).CreateObjectRefreshRepo()
+
+	require.NoError(t, refreshRepo.DenyAccessToken(ctx, "guid", c.now.Add(time.Minute)))
+
+	denied, err := refreshRepo.IsAccessTokenDenied(ctx, "guid")
+	require.NoError(t, err)
+	require.True(t, denied)
+
+	c.now = c.now.Add(time.Minute)
+
+	denied, err = refreshRepo.IsAccessTokenDenied(ctx, "guid")
+	require.NoError(t, err)
+	require.False(t, denied)
+
+	require.NoError(t, refreshRepo.DenyAccessToken(ctx, "other", c.now.Add(time.Minute)))
+	require.NotContains(t, refreshRepo.denylist, "guid")
+}
@@ -2,58 +2,127 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	usersCollection = "users"
-	name            = "name"
-	rToken          = "refresh_token"
-	createdTime     = "created_time"
+	usersCollection    = "users"
+	profilesCollection = "profiles"
+	denylistCollection = "denylist"
+	name               = "name"
+	tID                = "token_id"
+	fID                = "family_id"
+	used               = "used"
+	usedTime           = "used_time"
+	sessionCreatedTime = "session_created_time"
+	guid               = "guid"
+	expiresTime        = "expires_time"
+	nextToken          = "next_token"
+	email              = "email"
+	roles              = "roles"
+	tenant             = "tenant"
 )
 
+const tracerName = "github.com/DarRo9/Test-task-BackDev/internal/storage/mongodb"
+
 type RefreshRepo struct {
-	db *mongo.Collection
+	client       *mongo.Client
+	db           *mongo.Collection
+	profiles     *mongo.Collection
+	denylist     *mongo.Collection
+	transactions bool
+	metrics      Metrics
+}
+
+// Metrics observes how long storage operations take.
+type Metrics interface {
+	ObserveStorage(method string, duration time.Duration)
 }
 
 type Storage struct {
-	db *mongo.Database
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+// SetMetrics starts observing the latency of every operation. It must be called before the repo is used.
+func (r *RefreshRepo) SetMetrics(metrics Metrics) {
+	r.metrics = metrics
+}
+
+// observe starts a span for the operation. The returned func ends it with the operation
+// error and records the latency.
+func (r *RefreshRepo) observe(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "mongodb."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mongodb"), attribute.String("db.operation", method)))
+
+	return ctx, func(err error) {
+		if err != nil && !errors.Is(err, storage.ErrTokenNotFound) && !errors.Is(err, storage.ErrProfileNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+
+		if r.metrics != nil {
+			r.metrics.ObserveStorage(method, time.Since(start))
+		}
+	}
 }
 
-func (r *RefreshRepo) DeleteToken(ctx context.Context, refreshToken string) error {
+func (r *RefreshRepo) DeleteToken(ctx context.Context, tokenID string) (err error) {
 	const op = "storage.mongodb.DeleteToken"
 
-	filter := bson.M{rToken: refreshToken}
+	ctx, done := r.observe(ctx, "DeleteToken")
+	defer func() { done(err) }()
+
+	filter := bson.M{tID: tokenID}
 
 	if _, err := r.db.DeleteOne(ctx, filter); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	// A copy left by an unfinished rotation would bring the token back on the next read.
+	if _, err := r.db.UpdateMany(ctx, bson.M{nextToken + "." + tID: tokenID}, bson.M{"$unset": bson.M{nextToken: ""}}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	return nil
 }
 
-func (r *RefreshRepo) InsertToken(ctx context.Context, userName string, refreshToken string, timeNow time.Time) error {
+func (r *RefreshRepo) InsertToken(ctx context.Context, token models.User) (err error) {
 	const op = "storage.mongodb.InsertToken"
 
-	if _, err := r.db.InsertOne(ctx, models.User{
-		Name:         userName,
-		RefreshToken: refreshToken,
-		CreatedTime:  timeNow,
-	}); err != nil {
+	ctx, done := r.observe(ctx, "InsertToken")
+	defer func() { done(err) }()
+
+	if _, err := r.db.InsertOne(ctx, token); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) error {
+func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) (err error) {
 	const op = "storage.mongodb.DeleteTokensByUser"
 
+	ctx, done := r.observe(ctx, "DeleteTokensByUser")
+	defer func() { done(err) }()
+
 	filter := bson.M{name: userName}
 
 	if _, err := r.db.DeleteMany(ctx, filter); err != nil {
@@ -63,40 +132,236 @@ func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) e
 	return nil
 }
 
-func (r *RefreshRepo) GetTokenByUser(ctx context.Context, userName string) (string, error) {
-	const op = "storage.mongodb.GetTokenByUser"
+func (r *RefreshRepo) GetTokenByID(ctx context.Context, tokenID string) (_ models.User, err error) {
+	const op = "storage.mongodb.GetTokenByID"
 
-	filter := bson.M{name: userName}
+	ctx, done := r.observe(ctx, "GetTokenByID")
+	defer func() { done(err) }()
+
+	filter := bson.M{tID: tokenID}
 
 	var user models.User
-	err := r.db.FindOne(ctx, filter).Decode(&user)
+	err = r.db.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		user, err = r.getPendingToken(ctx, tokenID)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// pendingRotation is a rotated token whose successor is not in its own document yet.
+type pendingRotation struct {
+	TokenID string      `bson:"token_id"`
+	Next    models.User `bson:"next_token"`
+}
+
+// getPendingToken finds a new token that so far only exists inside the token it replaced
+// and finishes that rotation.
+func (r *RefreshRepo) getPendingToken(ctx context.Context, tokenID string) (models.User, error) {
+	var pending pendingRotation
+	if err := r.db.FindOne(ctx, bson.M{nextToken + "." + tID: tokenID}).Decode(&pending); err != nil {
+		return models.User{}, err
+	}
+
+	if err := r.completeRotation(ctx, pending.TokenID, pending.Next); err != nil {
+		return models.User{}, err
+	}
+
+	return pending.Next, nil
+}
+
+// completePendingRotations finishes the rotations of the user that stopped after the old token was marked used.
+func (r *RefreshRepo) completePendingRotations(ctx context.Context, userName string) error {
+	cursor, err := r.db.Find(ctx, bson.M{name: userName, nextToken: bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	var pending []pendingRotation
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		if err := r.completeRotation(ctx, p.TokenID, p.Next); err != nil {
+			return err
+		}
 	}
 
-	return user.RefreshToken, nil
+	return nil
 }
 
-func (r *RefreshRepo) SelectToken(ctx context.Context, oldRefreshToken string, CreateObjectRefreshToken string, userName string, timeNow time.Time) error {
+// SelectToken marks the old token as used only if nobody has done it before and stores the new one.
+// It runs in a transaction when the deployment supports it, see rotateToken for standalone servers.
+func (r *RefreshRepo) SelectToken(ctx context.Context, oldTokenID string, token models.User) (err error) {
 	const op = "storage.mongodb.SelectToken"
 
-	if err := r.DeleteToken(ctx, oldRefreshToken); err != nil {
+	ctx, done := r.observe(ctx, "SelectToken")
+	defer func() { done(err) }()
+
+	if !r.transactions {
+		if err := r.rotateToken(ctx, oldTokenID, token); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		// The rotation is done once the old token holds the new one. If moving the new one
+		// to its own document fails here, the next read of it finishes the move.
+		_ = r.completeRotation(ctx, oldTokenID, token)
+
+		return nil
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer session.EndSession(ctx)
+
+	if _, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := r.rotateToken(sc, oldTokenID, token); err != nil {
+			return nil, err
+		}
+
+		return nil, r.completeRotation(sc, oldTokenID, token)
+	}); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := r.InsertToken(ctx, userName, CreateObjectRefreshToken, timeNow); err != nil {
+	return nil
+}
+
+// rotateToken marks the old token as used and stores the new one inside it in a single conditional
+// write, so a rotation either happens completely or not at all and cannot happen twice.
+// Until completeRotation moves the new token to its own document, reads find it in the old one.
+func (r *RefreshRepo) rotateToken(ctx context.Context, oldTokenID string, token models.User) error {
+	filter := bson.M{tID: oldTokenID, used: false}
+	update := bson.M{"$set": bson.M{used: true, usedTime: token.CreatedTime, nextToken: token}}
+
+	err := r.db.FindOneAndUpdate(ctx, filter, update).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.ErrTokenAlreadyRotated
+	}
+
+	return err
+}
+
+// completeRotation writes the new token to its own document and drops the copy kept in the old one.
+// Both steps can be repeated safely.
+func (r *RefreshRepo) completeRotation(ctx context.Context, oldTokenID string, token models.User) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	var document bson.M
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	delete(document, tID)
+
+	if _, err := r.db.UpdateOne(ctx,
+		bson.M{tID: token.TokenID},
+		bson.M{"$setOnInsert": document},
+		options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+
+	if _, err := r.db.UpdateOne(ctx, bson.M{tID: oldTokenID}, bson.M{"$unset": bson.M{nextToken: ""}}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DetectTransactions enables transactional rotation on replica sets and sharded clusters.
+// Servers older than 4.4.2 do not know hello and are asked with isMaster instead.
+func (r *RefreshRepo) DetectTransactions(ctx context.Context) error {
+	const op = "storage.mongodb.DetectTransactions"
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	admin := r.client.Database("admin")
+
+	err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		var commandErr mongo.CommandError
+		if !errors.As(err, &commandErr) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	r.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+
+	return nil
+}
+
+func (r *RefreshRepo) RevokeFamily(ctx context.Context, familyID string) (err error) {
+	const op = "storage.mongodb.RevokeFamily"
+
+	ctx, done := r.observe(ctx, "RevokeFamily")
+	defer func() { done(err) }()
+
+	filter := bson.M{fID: familyID}
+
+	if _, err := r.db.DeleteMany(ctx, filter); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (int64, error) {
+func (r *RefreshRepo) GetSessionsByUser(ctx context.Context, userName string) (_ []models.User, err error) {
+	const op = "storage.mongodb.GetSessionsByUser"
+
+	ctx, done := r.observe(ctx, "GetSessionsByUser")
+	defer func() { done(err) }()
+
+	if err := r.completePendingRotations(ctx, userName); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	filter := liveTokens(userName)
+	opts := options.Find().SetSort(bson.D{{Key: sessionCreatedTime, Value: 1}})
+
+	cursor, err := r.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var sessions []models.User
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (_ int64, err error) {
 	const op = "storage.mongodb.CountTokens"
 
-	filter := bson.M{name: userName}
+	ctx, done := r.observe(ctx, "CountTokens")
+	defer func() { done(err) }()
+
+	if err := r.completePendingRotations(ctx, userName); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	filter := liveTokens(userName)
 
-	count, err := r.db.CountDocuments(context.Background(), filter)
+	count, err := r.db.CountDocuments(ctx, filter)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -104,26 +369,152 @@ func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (int64,
 	return count, nil
 }
 
-func (r *RefreshRepo) GetTime(ctx context.Context, refreshToken string, userName string) (time.Time, error) {
-	const op = "storage.mongodb.GetTime"
+// liveTokens matches the unused tokens of the user that have not expired yet.
+// Records without expires_time were written before it existed and never expire.
+func liveTokens(userName string) bson.M {
+	return bson.M{
+		name: userName,
+		used: false,
+		"$or": bson.A{
+			bson.M{expiresTime: bson.M{"$gt": time.Now()}},
+			bson.M{expiresTime: bson.M{"$exists": false}},
+		},
+	}
+}
 
-	filter := bson.M{rToken: refreshToken, name: userName}
+func (r *RefreshRepo) GetEmail(ctx context.Context, userName string) (_ string, err error) {
+	const op = "storage.mongodb.GetEmail"
 
-	var user models.User
-	err := r.db.FindOne(ctx, filter).Decode(&user)
+	ctx, done := r.observe(ctx, "GetEmail")
+	defer func() { done(err) }()
+
+	filter := bson.M{name: userName}
+
+	var profile models.Profile
+	err = r.profiles.FindOne(ctx, filter).Decode(&profile)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return profile.Email, nil
+}
+
+func (r *RefreshRepo) GetProfile(ctx context.Context, userName string) (_ models.Profile, err error) {
+	const op = "storage.mongodb.GetProfile"
+
+	ctx, done := r.observe(ctx, "GetProfile")
+	defer func() { done(err) }()
+
+	filter := bson.M{name: userName}
+
+	var profile models.Profile
+	err = r.profiles.FindOne(ctx, filter).Decode(&profile)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return profile, nil
+}
+
+func (r *RefreshRepo) InsertProfile(ctx context.Context, profile models.Profile) (err error) {
+	const op = "storage.mongodb.InsertProfile"
+
+	ctx, done := r.observe(ctx, "InsertProfile")
+	defer func() { done(err) }()
+
+	filter := bson.M{name: profile.Name}
+	update := bson.M{"$set": bson.M{name: profile.Name, email: profile.Email, roles: profile.Roles, tenant: profile.Tenant}}
+
+	if _, err := r.profiles.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) DenyAccessToken(ctx context.Context, accessTokenGUID string, expiresAt time.Time) (err error) {
+	const op = "storage.mongodb.DenyAccessToken"
+
+	ctx, done := r.observe(ctx, "DenyAccessToken")
+	defer func() { done(err) }()
+
+	filter := bson.M{guid: accessTokenGUID}
+	update := bson.M{"$set": bson.M{guid: accessTokenGUID, expiresTime: expiresAt}}
+
+	if _, err := r.denylist.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (_ bool, err error) {
+	const op = "storage.mongodb.IsAccessTokenDenied"
+
+	ctx, done := r.observe(ctx, "IsAccessTokenDenied")
+	defer func() { done(err) }()
+
+	filter := bson.M{guid: accessTokenGUID, expiresTime: bson.M{"$gt": time.Now()}}
+
+	count, err := r.denylist.CountDocuments(ctx, filter, options.Count().SetLimit(1))
 	if err != nil {
-		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *RefreshRepo) CreateIndexes(ctx context.Context) error {
+	const op = "storage.mongodb.CreateIndexes"
+
+	if _, err := r.db.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: tID, Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: expiresTime, Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys:    bson.D{{Key: nextToken + "." + tID, Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return user.CreatedTime, nil
+	if _, err := r.denylist.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: guid, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: expiresTime, Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
 
 func CreateObjectStorage(client *mongo.Client, database string) *Storage {
-	return &Storage{db: client.Database(database)}
+	return &Storage{client: client, db: client.Database(database)}
 }
 
 func (s *Storage) CreateObjectRefreshRepo() *RefreshRepo {
 	return &RefreshRepo{
-		db: s.db.Collection(usersCollection),
+		client:   s.client,
+		db:       s.db.Collection(usersCollection),
+		profiles: s.db.Collection(profilesCollection),
+		denylist: s.db.Collection(denylistCollection),
 	}
 }
@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/storagetest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startMongod(t *testing.T) *mongo.Client {
+	path, err := exec.LookPath("mongod")
+	if err != nil {
+		t.Skip("mongod binary is not found")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cmd := exec.Command(path, "--dbpath", t.TempDir(), "--bind_ip", "127.0.0.1", "--port", fmt.Sprint(port))
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	uri := fmt.Sprintf("mongodb://127.0.0.1:%d", port)
+
+	var client *mongo.Client
+	require.Eventually(t, func() bool {
+		client, err = CreateObjectClient(uri, "", "")
+		return err == nil
+	}, 30*time.Second, 100*time.Millisecond)
+
+	t.Cleanup(func() {
+		client.Disconnect(context.Background())
+	})
+
+	return client
+}
+
+func TestStorage(t *testing.T) {
+	client := startMongod(t)
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		ctx := context.Background()
+
+		refreshRepo := CreateObjectStorage(client, "test_"+uuid.New().String()[:8]).CreateObjectRefreshRepo()
+		require.NoError(t, refreshRepo.CreateIndexes(ctx))
+		require.NoError(t, refreshRepo.DetectTransactions(ctx))
+
+		return refreshRepo
+	}, storagetest.WithBackgroundExpiry())
+}
+
+type fakeMetrics struct {
+	methods []string
+}
+
+func (m *fakeMetrics) ObserveStorage(method string, duration time.Duration) {
+	m.methods = append(m.methods, method)
+}
+
+func TestRefreshRepoMetrics(t *testing.T) {
+	opts := options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50 * time.Millisecond)
+
+	client, err := mongo.Connect(context.Background(), opts)
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+
+	metrics := &fakeMetrics{}
+	refreshRepo := CreateObjectStorage(client, "test").CreateObjectRefreshRepo()
+	refreshRepo.SetMetrics(metrics)
+
+	_, err = refreshRepo.CountTokens(context.Background(), "user")
+	require.Error(t, err)
+
+	_, err = refreshRepo.GetTokenByID(context.Background(), "token")
+	require.Error(t, err)
+
+	require.Equal(t, []string{"CountTokens", "GetTokenByID"}, metrics.methods)
+}
+
+func TestRefreshRepoTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	opts := options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50 * time.Millisecond)
+
+	client, err := mongo.Connect(context.Background(), opts)
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+
+	refreshRepo := CreateObjectStorage(client, "test").CreateObjectRefreshRepo()
+
+	_, err = refreshRepo.CountTokens(context.Background(), "user")
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "mongodb.CountTokens", spans[0].Name())
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	require.Contains(t, spans[0].Attributes(), attribute.String("db.system", "mongodb"))
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestUnfinishedRotation(t *testing.T) {
+	client := startMongod(t)
+	ctx := context.Background()
+
+	refreshRepo := CreateObjectStorage(client, "test_"+uuid.New().String()[:8]).CreateObjectRefreshRepo()
+	require.NoError(t, refreshRepo.CreateIndexes(ctx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	oldToken := models.User{Name: "user", TokenID: uuid.New().String(), FamilyID: "family", CreatedTime: now, ExpiresTime: now.Add(time.Hour)}
+	newToken := models.User{Name: "user", TokenID: uuid.New().String(), FamilyID: "family", CreatedTime: now, ExpiresTime: now.Add(time.Hour)}
+
+	require.NoError(t, refreshRepo.InsertToken(ctx, oldToken))
+
+	// Only the conditional write happens, as if the process stopped right after it.
+	require.NoError(t, refreshRepo.rotateToken(ctx, oldToken.TokenID, newToken))
+	require.ErrorIs(t, refreshRepo.rotateToken(ctx, oldToken.TokenID, newToken), storage.ErrTokenAlreadyRotated)
+
+	count, err := refreshRepo.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	got, err := refreshRepo.GetTokenByID(ctx, newToken.TokenID)
+	require.NoError(t, err)
+	require.Equal(t, "family", got.FamilyID)
+	require.False(t, got.Used)
+
+	old, err := refreshRepo.GetTokenByID(ctx, oldToken.TokenID)
+	require.NoError(t, err)
+	require.True(t, old.Used)
+
+	pending, err := client.Database(refreshRepo.db.Database().Name()).Collection(usersCollection).
+		CountDocuments(ctx, bson.M{nextToken: bson.M{"$exists": true}})
+	require.NoError(t, err)
+	require.Zero(t, pending)
+}
+
+func TestDeleteUnfinishedRotation(t *testing.T) {
+	client := startMongod(t)
+	ctx := context.Background()
+
+	refreshRepo := CreateObjectStorage(client, "test_"+uuid.New().String()[:8]).CreateObjectRefreshRepo()
+	require.NoError(t, refreshRepo.CreateIndexes(ctx))
+
+	oldToken := models.User{Name: "user", TokenID: uuid.New().String(), FamilyID: "family"}
+	newToken := models.User{Name: "user", TokenID: uuid.New().String(), FamilyID: "family"}
+
+	require.NoError(t, refreshRepo.InsertToken(ctx, oldToken))
+	require.NoError(t, refreshRepo.rotateToken(ctx, oldToken.TokenID, newToken))
+	require.NoError(t, refreshRepo.DeleteToken(ctx, newToken.TokenID))
+
+	_, err := refreshRepo.GetTokenByID(ctx, newToken.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+}
@@ -0,0 +1,309 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const tokenColumns = `token_id, name, refresh_token, pair_id, family_id, device, ip, created_time, session_created_time, used, used_time, expires_time`
+
+// liveTokens matches the unused tokens of the user in $1 that have not expired yet.
+// Rows without expires_time were written before it existed and never expire.
+const liveTokens = `name = $1 AND NOT used AND (expires_time IS NULL OR expires_time > now())`
+
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+type RefreshRepo struct {
+	db *pgxpool.Pool
+}
+
+type Storage struct {
+	db *pgxpool.Pool
+}
+
+func (r *RefreshRepo) DeleteToken(ctx context.Context, tokenID string) error {
+	const op = "storage.postgres.DeleteToken"
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE token_id = $1`, tokenID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) InsertToken(ctx context.Context, token models.User) error {
+	const op = "storage.postgres.InsertToken"
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := deleteExpiredTokens(ctx, tx); err != nil {
+			return err
+		}
+
+		return insertToken(ctx, tx, token)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) DeleteTokensByUser(ctx context.Context, userName string) error {
+	const op = "storage.postgres.DeleteTokensByUser"
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE name = $1`, userName); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) GetTokenByID(ctx context.Context, tokenID string) (models.User, error) {
+	const op = "storage.postgres.GetTokenByID"
+
+	row := r.db.QueryRow(ctx, `SELECT `+tokenColumns+` FROM refresh_tokens WHERE token_id = $1`, tokenID)
+
+	user, err := scanToken(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrTokenNotFound)
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// SelectToken marks the old token as used and inserts the new one in a single transaction.
+// The old token is marked before the expired tokens are deleted, so it can't expire in between.
+func (r *RefreshRepo) SelectToken(ctx context.Context, oldTokenID string, token models.User) error {
+	const op = "storage.postgres.SelectToken"
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE refresh_tokens SET used = TRUE, used_time = $2 WHERE token_id = $1 AND NOT used`,
+			oldTokenID, token.CreatedTime)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return storage.ErrTokenAlreadyRotated
+		}
+
+		if err := deleteExpiredTokens(ctx, tx); err != nil {
+			return err
+		}
+
+		return insertToken(ctx, tx, token)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	const op = "storage.postgres.RevokeFamily"
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE family_id = $1`, familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) GetSessionsByUser(ctx context.Context, userName string) ([]models.User, error) {
+	const op = "storage.postgres.GetSessionsByUser"
+
+	rows, err := r.db.Query(ctx,
+		`SELECT `+tokenColumns+` FROM refresh_tokens WHERE `+liveTokens+` ORDER BY session_created_time`,
+		userName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.User
+	for rows.Next() {
+		session, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (r *RefreshRepo) CountTokens(ctx context.Context, userName string) (int64, error) {
+	const op = "storage.postgres.CountTokens"
+
+	var count int64
+	if err := r.db.QueryRow(ctx,
+		`SELECT count(*) FROM refresh_tokens WHERE `+liveTokens,
+		userName).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+func (r *RefreshRepo) GetEmail(ctx context.Context, userName string) (string, error) {
+	const op = "storage.postgres.GetEmail"
+
+	var email string
+	err := r.db.QueryRow(ctx, `SELECT email FROM profiles WHERE name = $1`, userName).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return email, nil
+}
+
+func (r *RefreshRepo) GetProfile(ctx context.Context, userName string) (models.Profile, error) {
+	const op = "storage.postgres.GetProfile"
+
+	profile := models.Profile{Name: userName}
+	err := r.db.QueryRow(ctx, `SELECT email, roles, tenant FROM profiles WHERE name = $1`, userName).
+		Scan(&profile.Email, &profile.Roles, &profile.Tenant)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, storage.ErrProfileNotFound)
+	}
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(profile.Roles) == 0 {
+		profile.Roles = nil
+	}
+
+	return profile, nil
+}
+
+func (r *RefreshRepo) InsertProfile(ctx context.Context, profile models.Profile) error {
+	const op = "storage.postgres.InsertProfile"
+
+	roles := profile.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	if _, err := r.db.Exec(ctx,
+		`INSERT INTO profiles (name, email, roles, tenant) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET email = EXCLUDED.email, roles = EXCLUDED.roles, tenant = EXCLUDED.tenant`,
+		profile.Name, profile.Email, roles, profile.Tenant); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) DenyAccessToken(ctx context.Context, accessTokenGUID string, expiresAt time.Time) error {
+	const op = "storage.postgres.DenyAccessToken"
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM denylist WHERE expires_time <= now()`); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO denylist (guid, expires_time) VALUES ($1, $2)
+			ON CONFLICT (guid) DO UPDATE SET expires_time = EXCLUDED.expires_time`,
+			accessTokenGUID, expiresAt)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *RefreshRepo) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error) {
+	const op = "storage.postgres.IsAccessTokenDenied"
+
+	var denied bool
+	if err := r.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM denylist WHERE guid = $1 AND expires_time > now())`,
+		accessTokenGUID).Scan(&denied); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return denied, nil
+}
+
+// deleteExpiredTokens runs on every write, because nothing else removes expired tokens from the table.
+func deleteExpiredTokens(ctx context.Context, db executor) error {
+	_, err := db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_time <= now()`)
+
+	return err
+}
+
+func insertToken(ctx context.Context, db executor, token models.User) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO refresh_tokens (`+tokenColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		token.TokenID, token.Name, token.RefreshToken, token.PairID, token.FamilyID, token.Device, token.IP,
+		token.CreatedTime, token.SessionCreatedTime, token.Used, nullTime(token.UsedTime), nullTime(token.ExpiresTime))
+
+	return err
+}
+
+func scanToken(row pgx.Row) (models.User, error) {
+	var user models.User
+	var usedTime, expiresTime *time.Time
+
+	if err := row.Scan(
+		&user.TokenID, &user.Name, &user.RefreshToken, &user.PairID, &user.FamilyID, &user.Device, &user.IP,
+		&user.CreatedTime, &user.SessionCreatedTime, &user.Used, &usedTime, &expiresTime); err != nil {
+		return models.User{}, err
+	}
+
+	if usedTime != nil {
+		user.UsedTime = *usedTime
+	}
+
+	if expiresTime != nil {
+		user.ExpiresTime = *expiresTime
+	}
+
+	return user, nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func CreateObjectStorage(pool *pgxpool.Pool) *Storage {
+	return &Storage{db: pool}
+}
+
+func (s *Storage) CreateObjectRefreshRepo() *RefreshRepo {
+	return &RefreshRepo{
+		db: s.db,
+	}
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI is not set")
+	}
+
+	pool, err := CreateObjectPool(uri, 10, 0, 0)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	postgresDatabase := CreateObjectStorage(pool)
+	require.NoError(t, postgresDatabase.Migrate(context.Background()))
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		_, err := pool.Exec(context.Background(), `TRUNCATE refresh_tokens, profiles, denylist`)
+		require.NoError(t, err)
+
+		return postgresDatabase.CreateObjectRefreshRepo()
+	})
+}
+
+func TestDenyAccessTokenDeletesExpired(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := CreateObjectPool(uri, 2, 0, 0)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	postgresDatabase := CreateObjectStorage(pool)
+	require.NoError(t, postgresDatabase.Migrate(ctx))
+
+	_, err = pool.Exec(ctx, `TRUNCATE denylist`)
+	require.NoError(t, err)
+
+	refreshRepo := postgresDatabase.CreateObjectRefreshRepo()
+	require.NoError(t, refreshRepo.DenyAccessToken(ctx, "expired", time.Now().Add(-time.Second)))
+	require.NoError(t, refreshRepo.DenyAccessToken(ctx, "live", time.Now().Add(time.Hour)))
+
+	var guids []string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT array_agg(guid) FROM denylist`).Scan(&guids))
+	require.Equal(t, []string{"live"}, guids)
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if uri == "" {
+		t.Skip("POSTGRES_TEST_URI is not set")
+	}
+
+	pool, err := CreateObjectPool(uri, 2, 0, 0)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	postgresDatabase := CreateObjectStorage(pool)
+	require.NoError(t, postgresDatabase.Migrate(context.Background()))
+	require.NoError(t, postgresDatabase.Migrate(context.Background()))
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	require.NoError(t, err)
+
+	var applied int
+	require.NoError(t, pool.QueryRow(context.Background(), `SELECT count(*) FROM schema_migrations`).Scan(&applied))
+	require.Equal(t, len(files), applied)
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for i, file := range files {
+		require.Regexp(t, `^migrations/\d{3}_[a-z_]+\.sql$`, file)
+		require.True(t, strings.HasPrefix(path.Base(file), fmt.Sprintf("%03d_", i+1)), file)
+
+		query, err := migrations.ReadFile(file)
+		require.NoError(t, err)
+		require.NotEmpty(t, strings.TrimSpace(string(query)))
+	}
+}
+
+func TestCreateObjectPoolInvalidURI(t *testing.T) {
+	_, err := CreateObjectPool("postgres://%zz", 1, 0, 0)
+	require.Error(t, err)
+
+	_, err = CreateObjectPool("postgres://user@127.0.0.1:1/db?connect_timeout=1", 1, 0, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_id             TEXT PRIMARY KEY,
+    name                 TEXT        NOT NULL,
+    refresh_token        TEXT        NOT NULL,
+    pair_id              TEXT        NOT NULL,
+    family_id            TEXT        NOT NULL,
+    device               TEXT        NOT NULL DEFAULT '',
+    ip                   TEXT        NOT NULL DEFAULT '',
+    created_time         TIMESTAMPTZ NOT NULL,
+    session_created_time TIMESTAMPTZ NOT NULL,
+    used                 BOOLEAN     NOT NULL DEFAULT FALSE,
+    used_time            TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_name_used_idx ON refresh_tokens (name, used);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS profiles (
+    name  TEXT PRIMARY KEY,
+    email TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS denylist (
+    guid         TEXT PRIMARY KEY,
+    expires_time TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS denylist_expires_time_idx ON denylist (expires_time);
@@ -0,0 +1,3 @@
+ALTER TABLE profiles
+    ADD COLUMN IF NOT EXISTS roles  TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS tenant TEXT   NOT NULL DEFAULT '';
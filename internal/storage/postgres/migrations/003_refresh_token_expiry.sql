@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS expires_time TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_time_idx ON refresh_tokens (expires_time);
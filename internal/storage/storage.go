@@ -0,0 +1,9 @@
+package storage
+
+import "errors"
+
+var (
+	ErrTokenNotFound       = errors.New("token not found")
+	ErrTokenAlreadyRotated = errors.New("token already rotated")
+	ErrProfileNotFound     = errors.New("profile not found")
+)
@@ -0,0 +1,462 @@
+// Package storagetest is a conformance suite every service.Storage backend must pass.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/models"
+	"github.com/DarRo9/Test-task-BackDev/internal/service"
+	"github.com/DarRo9/Test-task-BackDev/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type Storage interface {
+	service.Storage
+	InsertProfile(ctx context.Context, profile models.Profile) error
+}
+
+// Factory returns an empty backend. It is called once per subtest.
+type Factory func(t *testing.T) Storage
+
+type options struct {
+	backgroundExpiry bool
+}
+
+type Option func(*options)
+
+// WithBackgroundExpiry is for backends that drop expired rows asynchronously, like a Mongo TTL index.
+// The suite then doesn't expect a write to have collected them.
+func WithBackgroundExpiry() Option {
+	return func(o *options) {
+		o.backgroundExpiry = true
+	}
+}
+
+func Run(t *testing.T, factory Factory, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Storage)
+	}{
+		{"InsertAndGetToken", testInsertAndGetToken},
+		{"InsertDuplicateToken", testInsertDuplicateToken},
+		{"NotFound", testNotFound},
+		{"SelectToken", testSelectToken},
+		{"SelectTokenRace", testSelectTokenRace},
+		{"RevokeFamily", testRevokeFamily},
+		{"DeleteTokensByUser", testDeleteTokensByUser},
+		{"Sessions", testSessions},
+		{"ExpiredSessions", testExpiredSessions},
+		{"TokenExpiry", testTokenExpiry},
+		{"ExpiredTokensCollected", testExpiredTokensCollected},
+		{"Denylist", testDenylist},
+		{"DenylistExpiry", testDenylistExpiry},
+		{"GetEmail", testGetEmail},
+		{"GetProfile", testGetProfile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if o.backgroundExpiry && tt.name == "ExpiredTokensCollected" {
+				t.Skip("expired rows are collected in the background")
+			}
+
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+func makeToken(userName string, familyID string, sessionCreatedTime time.Time) models.User {
+	return models.User{
+		Name:               userName,
+		TokenID:            uuid.New().String(),
+		RefreshToken:       "hash",
+		PairID:             uuid.New().String(),
+		FamilyID:           familyID,
+		Device:             "device",
+		IP:                 "127.0.0.1",
+		CreatedTime:        sessionCreatedTime,
+		SessionCreatedTime: sessionCreatedTime,
+		ExpiresTime:        sessionCreatedTime.Add(time.Hour),
+	}
+}
+
+func timeNow() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func testInsertAndGetToken(t *testing.T, s Storage) {
+	ctx := context.Background()
+	token := makeToken("user", uuid.New().String(), timeNow())
+
+	require.NoError(t, s.InsertToken(ctx, token))
+
+	got, err := s.GetTokenByID(ctx, token.TokenID)
+	require.NoError(t, err)
+	require.Equal(t, token.Name, got.Name)
+	require.Equal(t, token.RefreshToken, got.RefreshToken)
+	require.Equal(t, token.PairID, got.PairID)
+	require.Equal(t, token.FamilyID, got.FamilyID)
+	require.Equal(t, token.Device, got.Device)
+	require.Equal(t, token.IP, got.IP)
+	require.True(t, token.CreatedTime.Equal(got.CreatedTime))
+	require.True(t, token.SessionCreatedTime.Equal(got.SessionCreatedTime))
+	require.True(t, token.ExpiresTime.Equal(got.ExpiresTime))
+	require.False(t, got.Used)
+
+	require.NoError(t, s.DeleteToken(ctx, token.TokenID))
+
+	_, err = s.GetTokenByID(ctx, token.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+}
+
+func testInsertDuplicateToken(t *testing.T, s Storage) {
+	ctx := context.Background()
+	token := makeToken("user", uuid.New().String(), timeNow())
+
+	require.NoError(t, s.InsertToken(ctx, token))
+	require.Error(t, s.InsertToken(ctx, token))
+}
+
+func testNotFound(t *testing.T, s Storage) {
+	ctx := context.Background()
+	tokenID := uuid.New().String()
+
+	_, err := s.GetTokenByID(ctx, tokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	err = s.SelectToken(ctx, tokenID, makeToken("user", uuid.New().String(), timeNow()))
+	require.ErrorIs(t, err, storage.ErrTokenAlreadyRotated)
+
+	require.NoError(t, s.DeleteToken(ctx, tokenID))
+	require.NoError(t, s.DeleteTokensByUser(ctx, "nobody"))
+	require.NoError(t, s.RevokeFamily(ctx, uuid.New().String()))
+
+	count, err := s.CountTokens(ctx, "nobody")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func testSelectToken(t *testing.T, s Storage) {
+	ctx := context.Background()
+	familyID := uuid.New().String()
+
+	oldToken := makeToken("user", familyID, timeNow())
+	require.NoError(t, s.InsertToken(ctx, oldToken))
+
+	newToken := makeToken("user", familyID, oldToken.SessionCreatedTime)
+	newToken.CreatedTime = oldToken.CreatedTime.Add(time.Second)
+	require.NoError(t, s.SelectToken(ctx, oldToken.TokenID, newToken))
+
+	got, err := s.GetTokenByID(ctx, oldToken.TokenID)
+	require.NoError(t, err)
+	require.True(t, got.Used)
+	require.True(t, newToken.CreatedTime.Equal(got.UsedTime))
+
+	got, err = s.GetTokenByID(ctx, newToken.TokenID)
+	require.NoError(t, err)
+	require.False(t, got.Used)
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	err = s.SelectToken(ctx, oldToken.TokenID, makeToken("user", familyID, oldToken.SessionCreatedTime))
+	require.ErrorIs(t, err, storage.ErrTokenAlreadyRotated)
+}
+
+func testSelectTokenRace(t *testing.T, s Storage) {
+	const workers = 8
+
+	ctx := context.Background()
+	familyID := uuid.New().String()
+
+	oldToken := makeToken("user", familyID, timeNow())
+	require.NoError(t, s.InsertToken(ctx, oldToken))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.SelectToken(ctx, oldToken.TokenID, makeToken("user", familyID, oldToken.SessionCreatedTime))
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var succeeded int
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+
+		require.True(t, errors.Is(err, storage.ErrTokenAlreadyRotated), "unexpected error: %v", err)
+	}
+
+	require.Equal(t, 1, succeeded)
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func testRevokeFamily(t *testing.T, s Storage) {
+	ctx := context.Background()
+	familyID := uuid.New().String()
+
+	oldToken := makeToken("user", familyID, timeNow())
+	require.NoError(t, s.InsertToken(ctx, oldToken))
+
+	newToken := makeToken("user", familyID, oldToken.SessionCreatedTime)
+	require.NoError(t, s.SelectToken(ctx, oldToken.TokenID, newToken))
+
+	otherToken := makeToken("user", uuid.New().String(), timeNow())
+	require.NoError(t, s.InsertToken(ctx, otherToken))
+
+	require.NoError(t, s.RevokeFamily(ctx, familyID))
+
+	_, err := s.GetTokenByID(ctx, oldToken.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.GetTokenByID(ctx, newToken.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.GetTokenByID(ctx, otherToken.TokenID)
+	require.NoError(t, err)
+}
+
+func testDeleteTokensByUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	first := makeToken("user", uuid.New().String(), timeNow())
+	second := makeToken("user", uuid.New().String(), timeNow())
+	other := makeToken("other", uuid.New().String(), timeNow())
+
+	for _, token := range []models.User{first, second, other} {
+		require.NoError(t, s.InsertToken(ctx, token))
+	}
+
+	require.NoError(t, s.DeleteTokensByUser(ctx, "user"))
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	_, err = s.GetTokenByID(ctx, first.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.GetTokenByID(ctx, other.TokenID)
+	require.NoError(t, err)
+}
+
+func testSessions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	timeStart := timeNow()
+
+	second := makeToken("user", uuid.New().String(), timeStart.Add(time.Minute))
+	first := makeToken("user", uuid.New().String(), timeStart)
+	other := makeToken("other", uuid.New().String(), timeStart)
+
+	for _, token := range []models.User{second, first, other} {
+		require.NoError(t, s.InsertToken(ctx, token))
+	}
+
+	sessions, err := s.GetSessionsByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, first.TokenID, sessions[0].TokenID)
+	require.Equal(t, second.TokenID, sessions[1].TokenID)
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	sessions, err = s.GetSessionsByUser(ctx, "nobody")
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
+
+// testExpiredSessions checks that sessions nobody refreshed before they expired
+// do not count towards the session limit and are not offered for eviction.
+func testExpiredSessions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	timeStart := timeNow()
+
+	expired := makeToken("user", uuid.New().String(), timeStart.Add(-2*time.Hour))
+	live := makeToken("user", uuid.New().String(), timeStart)
+	legacy := makeToken("user", uuid.New().String(), timeStart.Add(time.Minute))
+	legacy.ExpiresTime = time.Time{}
+
+	for _, token := range []models.User{expired, live, legacy} {
+		require.NoError(t, s.InsertToken(ctx, token))
+	}
+
+	sessions, err := s.GetSessionsByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, live.TokenID, sessions[0].TokenID)
+	require.Equal(t, legacy.TokenID, sessions[1].TokenID)
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	onlyExpired := makeToken("expired", uuid.New().String(), timeStart.Add(-2*time.Hour))
+	require.NoError(t, s.InsertToken(ctx, onlyExpired))
+
+	count, err = s.CountTokens(ctx, "expired")
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	sessions, err = s.GetSessionsByUser(ctx, "expired")
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
+
+// testTokenExpiry checks that a rotation carries the expiry of the successor and that an expired
+// token is either still readable as it was stored or already collected.
+func testTokenExpiry(t *testing.T, s Storage) {
+	ctx := context.Background()
+	timeStart := timeNow()
+
+	oldToken := makeToken("user", uuid.New().String(), timeStart.Add(-time.Hour+time.Minute))
+	require.NoError(t, s.InsertToken(ctx, oldToken))
+
+	newToken := makeToken("user", oldToken.FamilyID, timeStart)
+	newToken.ExpiresTime = timeStart.Add(2 * time.Hour)
+	require.NoError(t, s.SelectToken(ctx, oldToken.TokenID, newToken))
+
+	got, err := s.GetTokenByID(ctx, newToken.TokenID)
+	require.NoError(t, err)
+	require.True(t, newToken.ExpiresTime.Equal(got.ExpiresTime))
+
+	sessions, err := s.GetSessionsByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, newToken.TokenID, sessions[0].TokenID)
+
+	expired := makeToken("user", uuid.New().String(), timeStart.Add(-2*time.Hour))
+	require.NoError(t, s.InsertToken(ctx, expired))
+
+	got, err = s.GetTokenByID(ctx, expired.TokenID)
+	if err != nil {
+		require.ErrorIs(t, err, storage.ErrTokenNotFound)
+	} else {
+		require.True(t, got.Expired(time.Now()))
+	}
+
+	count, err := s.CountTokens(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+// testExpiredTokensCollected checks that inserts and rotations delete the tokens that expired before them.
+func testExpiredTokensCollected(t *testing.T, s Storage) {
+	ctx := context.Background()
+	timeStart := timeNow()
+
+	expired := makeToken("user", uuid.New().String(), timeStart.Add(-2*time.Hour))
+	require.NoError(t, s.InsertToken(ctx, expired))
+
+	live := makeToken("user", uuid.New().String(), timeStart)
+	require.NoError(t, s.InsertToken(ctx, live))
+
+	_, err := s.GetTokenByID(ctx, expired.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	expired = makeToken("other", uuid.New().String(), timeStart.Add(-2*time.Hour))
+	require.NoError(t, s.InsertToken(ctx, expired))
+
+	require.NoError(t, s.SelectToken(ctx, live.TokenID, makeToken("user", live.FamilyID, timeStart)))
+
+	_, err = s.GetTokenByID(ctx, expired.TokenID)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.GetTokenByID(ctx, live.TokenID)
+	require.NoError(t, err)
+}
+
+func testDenylist(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	denied, err := s.IsAccessTokenDenied(ctx, "guid")
+	require.NoError(t, err)
+	require.False(t, denied)
+
+	require.NoError(t, s.DenyAccessToken(ctx, "guid", time.Now().Add(time.Hour)))
+
+	denied, err = s.IsAccessTokenDenied(ctx, "guid")
+	require.NoError(t, err)
+	require.True(t, denied)
+}
+
+func testDenylistExpiry(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.DenyAccessToken(ctx, "expired", time.Now().Add(-time.Second)))
+
+	denied, err := s.IsAccessTokenDenied(ctx, "expired")
+	require.NoError(t, err)
+	require.False(t, denied)
+
+	require.NoError(t, s.DenyAccessToken(ctx, "extended", time.Now().Add(-time.Second)))
+	require.NoError(t, s.DenyAccessToken(ctx, "extended", time.Now().Add(time.Hour)))
+
+	denied, err = s.IsAccessTokenDenied(ctx, "extended")
+	require.NoError(t, err)
+	require.True(t, denied)
+}
+
+func testGetEmail(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.InsertProfile(ctx, models.Profile{Name: "user", Email: "user@example.com"}))
+
+	email, err := s.GetEmail(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", email)
+
+	_, err = s.GetEmail(ctx, "nobody")
+	require.ErrorIs(t, err, storage.ErrProfileNotFound)
+}
+
+func testGetProfile(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.InsertProfile(ctx, models.Profile{Name: "plain", Email: "plain@example.com"}))
+	require.NoError(t, s.InsertProfile(ctx, models.Profile{
+		Name:   "user",
+		Email:  "user@example.com",
+		Roles:  []string{"admin", "user"},
+		Tenant: "acme",
+	}))
+
+	profile, err := s.GetProfile(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, "user", profile.Name)
+	require.Equal(t, "user@example.com", profile.Email)
+	require.Equal(t, []string{"admin", "user"}, profile.Roles)
+	require.Equal(t, "acme", profile.Tenant)
+
+	profile, err = s.GetProfile(ctx, "plain")
+	require.NoError(t, err)
+	require.Empty(t, profile.Roles)
+	require.Empty(t, profile.Tenant)
+
+	_, err = s.GetProfile(ctx, "nobody")
+	require.ErrorIs(t, err, storage.ErrProfileNotFound)
+}
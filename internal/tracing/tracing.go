@@ -0,0 +1,102 @@
+// Package tracing sets up OpenTelemetry tracing and joins slog records to the active span.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// Setup installs the global tracer provider and the W3C trace context propagator.
+// The returned func flushes the spans that are not exported yet.
+func Setup(ctx context.Context, config config.Tracing) (func(context.Context) error, error) {
+	const op = "tracing.Setup"
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := createObjectExporter(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if exporter == nil {
+		return func(context.Context) error {
+			return nil
+		}, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func createObjectExporter(ctx context.Context, tracing config.Tracing) (sdktrace.SpanExporter, error) {
+	switch tracing.Exporter {
+	case config.TracingOTLP:
+		var options []otlptracehttp.Option
+
+		if tracing.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(tracing.Endpoint))
+		}
+
+		if tracing.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(ctx, options...)
+	case config.TracingStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case config.TracingNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", tracing.Exporter)
+	}
+}
+
+// LogHandler adds the trace and span IDs of the span in the record context.
+type LogHandler struct {
+	slog.Handler
+}
+
+func CreateObjectLogHandler(handler slog.Handler) *LogHandler {
+	return &LogHandler{Handler: handler}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/config"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"golang.org/x/exp/slog"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := slog.New(CreateObjectLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	log.InfoContext(context.Background(), "without span")
+	require.NotContains(t, buf.String(), "trace_id")
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	log.With(slog.String("component", "test")).InfoContext(ctx, "with span")
+	require.Contains(t, buf.String(), "trace_id="+span.SpanContext().TraceID().String())
+	require.Contains(t, buf.String(), "span_id="+span.SpanContext().SpanID().String())
+	require.Contains(t, buf.String(), "component=test")
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: config.TracingNone})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup(context.Background(), config.Tracing{Exporter: config.TracingStdout, ServiceName: "test"})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), config.Tracing{Exporter: "zipkin"})
+	require.Error(t, err)
+}
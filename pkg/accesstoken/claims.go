@@ -0,0 +1,115 @@
+// Package accesstoken describes the claims of the access tokens issued by the auth service.
+package accesstoken
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrExpired is matched by the errors of verifiers when an access token is expired.
+var ErrExpired = errors.New("expired access token")
+
+// Claims are the registered claims of RFC 7519. Times are Unix seconds and zero means absent.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// IndividualRequirements are the claims of an access token. Custom claims such as roles
+// or tenant are written next to the registered ones and can never replace them.
+type IndividualRequirements struct {
+	Claims
+	GUID   string                 `json:"guid"`
+	IP     string                 `json:"ip"`
+	Custom map[string]interface{} `json:"-"`
+}
+
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"guid": true, "ip": true,
+}
+
+// individualRequirements has the fields of IndividualRequirements without its JSON methods.
+type individualRequirements IndividualRequirements
+
+func (r IndividualRequirements) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(individualRequirements(r))
+	if err != nil || len(r.Custom) == 0 {
+		return data, err
+	}
+
+	claims := make(map[string]interface{}, len(r.Custom))
+	for name, value := range r.Custom {
+		if !reservedClaims[name] {
+			claims[name] = value
+		}
+	}
+
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(claims)
+}
+
+func (r *IndividualRequirements) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*individualRequirements)(r)); err != nil {
+		return err
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+
+	for name := range claims {
+		if reservedClaims[name] {
+			delete(claims, name)
+		}
+	}
+
+	r.Custom = nil
+	if len(claims) > 0 {
+		r.Custom = claims
+	}
+
+	return nil
+}
+
+// Audience is written as a single string when it has one value and read from either form.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*a = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+
+	*a = many
+
+	return nil
+}
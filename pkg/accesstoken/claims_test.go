@@ -0,0 +1,42 @@
+package accesstoken
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudienceJSON(t *testing.T) {
+	b, err := json.Marshal(Claims{Audience: Audience{"api"}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"aud":"api"}`, string(b))
+
+	b, err = json.Marshal(Claims{Audience: Audience{"api", "gateway"}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"aud":["api","gateway"]}`, string(b))
+
+	var claims Claims
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":"api"}`), &claims))
+	require.Equal(t, Audience{"api"}, claims.Audience)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"aud":["api","gateway"]}`), &claims))
+	require.Equal(t, Audience{"api", "gateway"}, claims.Audience)
+
+	require.Error(t, json.Unmarshal([]byte(`{"aud":42}`), &claims))
+}
+
+func TestCustomClaimsJSON(t *testing.T) {
+	b, err := json.Marshal(IndividualRequirements{
+		Claims: Claims{Subject: "data"},
+		GUID:   "pair",
+		Custom: map[string]interface{}{"tenant": "acme", "sub": "intruder"},
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"sub":"data","guid":"pair","ip":"","tenant":"acme"}`, string(b))
+
+	var claims IndividualRequirements
+	require.NoError(t, json.Unmarshal(b, &claims))
+	require.Equal(t, "data", claims.Subject)
+	require.Equal(t, map[string]interface{}{"tenant": "acme"}, claims.Custom)
+}
@@ -0,0 +1,79 @@
+// Package authn is HTTP middleware that lets a service accept the access tokens issued by the auth service.
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/middleware/logger"
+	"github.com/DarRo9/Test-task-BackDev/pkg/accesstoken"
+)
+
+type contextKey struct{}
+
+type Verifier interface {
+	ParseJWT(accessToken string) (*accesstoken.IndividualRequirements, error)
+}
+
+type Denylist interface {
+	IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error)
+}
+
+// Authenticate rejects requests without a valid bearer access token
+// and stores its claims in the request context. A nil denylist is not consulted.
+func Authenticate(verifier Verifier, denylist Denylist) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || accessToken == "" {
+				unauthorized(w, r, "invalid_request", "Bearer token is missing")
+				return
+			}
+
+			claims, err := verifier.ParseJWT(accessToken)
+			if errors.Is(err, accesstoken.ErrExpired) {
+				unauthorized(w, r, "invalid_token", "Access token is expired")
+				return
+			}
+			if err != nil {
+				unauthorized(w, r, "invalid_token", "Access token is invalid")
+				return
+			}
+
+			if denylist != nil {
+				denied, err := denylist.IsAccessTokenDenied(r.Context(), claims.GUID)
+				if err != nil {
+					httperr.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal Server Error")
+					return
+				}
+
+				if denied {
+					unauthorized(w, r, "invalid_token", "Access token is revoked")
+					return
+				}
+			}
+
+			logger.SetSubject(r.Context(), claims.Subject)
+
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func WithClaims(ctx context.Context, claims *accesstoken.IndividualRequirements) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*accesstoken.IndividualRequirements, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*accesstoken.IndividualRequirements)
+
+	return claims, ok
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, code string, description string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`", error_description="`+description+`"`)
+	httperr.Write(w, r, http.StatusUnauthorized, code, description)
+}
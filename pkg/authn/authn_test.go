@@ -0,0 +1,92 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DarRo9/Test-task-BackDev/internal/auth"
+	"github.com/DarRo9/Test-task-BackDev/internal/http-server/httperr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	verifier, err := auth.CreateObject("12345", "67890")
+	require.NoError(t, err)
+
+	accessToken, err := verifier.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	var claims *auth.IndividualRequirements
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = ClaimsFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+
+	Authenticate(verifier, nil)(next).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, claims)
+	require.Equal(t, "data", claims.Subject)
+	require.Equal(t, "pair", claims.GUID)
+}
+
+func TestAuthenticateError(t *testing.T) {
+	verifier, err := auth.CreateObject("12345", "67890")
+	require.NoError(t, err)
+
+	expiredToken, err := verifier.CreateObjectJWT("data", "pair", "127.0.0.1", -time.Minute)
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler must not be called")
+	})
+
+	for _, header := range []string{"", "Bearer ", "Bearer invalid", "Bearer " + expiredToken} {
+		req := httptest.NewRequest("GET", "/protected", nil)
+		req.Header.Add("Authorization", header)
+		w := httptest.NewRecorder()
+
+		Authenticate(verifier, nil)(next).ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+		var response httperr.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.Error.Code)
+		require.NotEmpty(t, response.Error.Message)
+	}
+}
+
+type fakeDenylist map[string]bool
+
+func (d fakeDenylist) IsAccessTokenDenied(ctx context.Context, accessTokenGUID string) (bool, error) {
+	return d[accessTokenGUID], nil
+}
+
+func TestAuthenticateDenied(t *testing.T) {
+	verifier, err := auth.CreateObject("12345", "67890")
+	require.NoError(t, err)
+
+	accessToken, err := verifier.CreateObjectJWT("data", "pair", "127.0.0.1", time.Minute)
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler must not be called")
+	})
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+
+	Authenticate(verifier, fakeDenylist{"pair": true})(next).ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}